@@ -0,0 +1,46 @@
+package css
+
+import "fmt"
+
+// Declaration represents a parsed CSS property/value pair, e.g. `color: blue;`
+type Declaration struct {
+	Property  string
+	Value     string
+	Important bool
+
+	// Line and Column give the declaration's 1-based position in the input
+	// with its comments removed, so a comment earlier in the input shifts
+	// them from the original line and column. They are only populated by
+	// parser.ParseWithDiagnostics, and are ignored by Equal.
+	Line, Column int
+
+	// VarRefs holds every `var(--name[, fallback])` call found in Value, in
+	// order of occurrence, except those inside another var()'s fallback,
+	// which stay part of that fallback's text. It is ignored by Equal.
+	VarRefs []*VarRef
+}
+
+// NewDeclaration instanciates a new Declaration
+func NewDeclaration() *Declaration {
+	return &Declaration{}
+}
+
+// String returns the CSS string representation of the declaration
+func (d *Declaration) String() string {
+	result := fmt.Sprintf("%s: %s", d.Property, d.Value)
+
+	if d.Important {
+		result += " !important"
+	}
+
+	return result + ";"
+}
+
+// Equal returns true if both declarations are equivalent
+func (d *Declaration) Equal(other *Declaration) bool {
+	if other == nil {
+		return false
+	}
+
+	return d.Property == other.Property && d.Value == other.Value && d.Important == other.Important
+}
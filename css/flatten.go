@@ -0,0 +1,121 @@
+package css
+
+import "strings"
+
+// Flatten expands every nested rule (see the CSS Nesting Module) into an
+// equivalent flat rule, substituting `&` in each nested selector with every
+// comma-separated selector of its parent, a Cartesian product when both
+// sides have several. A nested selector with no `&` is implicitly
+// descendant-combined with its parent, per the Nesting Module's rules. A
+// nested `@media` (or other conditional at-rule) is hoisted into a
+// top-level copy of itself, wrapping the flattened selector it applied to.
+//
+// The returned rules' ParsedSelectors is left unset; re-parse Prelude with
+// parser.ParseSelectorList if a structured form is needed.
+func (s *Stylesheet) Flatten() *Stylesheet {
+	return &Stylesheet{Rules: flattenRules(s.Rules, nil)}
+}
+
+func flattenRules(rules []*Rule, parents []string) []*Rule {
+	var flat []*Rule
+
+	for _, rule := range rules {
+		if rule.Kind == AtRule {
+			flat = append(flat, flattenAtRule(rule, parents)...)
+			continue
+		}
+
+		selectors := substituteParent(parents, rule.Selectors)
+
+		if len(rule.Declarations) > 0 {
+			flat = append(flat, &Rule{
+				Kind:         QualifiedRule,
+				Prelude:      strings.Join(selectors, ", "),
+				Selectors:    selectors,
+				Declarations: rule.Declarations,
+				HasBlock:     true,
+			})
+		}
+
+		flat = append(flat, flattenRules(rule.Rules, selectors)...)
+	}
+
+	return flat
+}
+
+// flattenAtRule flattens an at-rule. With no enclosing qualified rule
+// (parents empty, the normal top-level case) it is left as-is, its own
+// nested rules flattened in place. Nested inside a qualified rule (parents
+// non-empty), its declarations apply directly to parents, so they're
+// wrapped in a synthetic qualified rule before being hoisted under a
+// top-level copy of the at-rule.
+func flattenAtRule(rule *Rule, parents []string) []*Rule {
+	wrapper := &Rule{Kind: AtRule, Name: rule.Name, Prelude: rule.Prelude, HasBlock: rule.HasBlock}
+	if !rule.HasBlock {
+		return []*Rule{wrapper}
+	}
+
+	if len(parents) == 0 {
+		wrapper.Declarations = rule.Declarations
+		wrapper.Rules = flattenRules(rule.Rules, nil)
+		return []*Rule{wrapper}
+	}
+
+	if len(rule.Declarations) > 0 {
+		wrapper.Rules = append(wrapper.Rules, &Rule{
+			Kind:         QualifiedRule,
+			Prelude:      strings.Join(parents, ", "),
+			Selectors:    append([]string(nil), parents...),
+			Declarations: rule.Declarations,
+			HasBlock:     true,
+		})
+	}
+
+	wrapper.Rules = append(wrapper.Rules, flattenRules(rule.Rules, parents)...)
+
+	return []*Rule{wrapper}
+}
+
+// substituteParent expands `&` in each of nested's selectors with every
+// selector of parents, a Cartesian product, or descendant-combines it with
+// parents if it contains no `&`. With no parents (top-level), nested is
+// returned unchanged.
+func substituteParent(parents []string, nested []string) []string {
+	if len(parents) == 0 {
+		return append([]string(nil), nested...)
+	}
+
+	var combined []string
+	for _, n := range nested {
+		if strings.Contains(n, "&") {
+			combined = append(combined, expandAmpersands(parents, n)...)
+		} else {
+			for _, p := range parents {
+				combined = append(combined, p+" "+n)
+			}
+		}
+	}
+	return combined
+}
+
+// expandAmpersands returns every selector obtained by substituting each `&`
+// in n with a selector of parents, independently of the others, a
+// Cartesian product over the occurrences. `& + &` against parents `a, b`
+// thus yields all of `a + a`, `a + b`, `b + a` and `b + b`, rather than
+// pairing same-index occurrences together.
+func expandAmpersands(parents []string, n string) []string {
+	pieces := strings.Split(n, "&")
+
+	results := []string{pieces[0]}
+	for _, piece := range pieces[1:] {
+		var next []string
+		for _, prefix := range results {
+			for _, p := range parents {
+				next = append(next, prefix+p+piece)
+			}
+		}
+		results = next
+	}
+
+	return results
+}
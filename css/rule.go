@@ -0,0 +1,200 @@
+package css
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RuleKind identifies whether a Rule is a qualified rule (a selector with a
+// declaration block) or an at-rule (`@media`, `@font-face`, ...)
+type RuleKind int
+
+const (
+	// QualifiedRule is a rule made of a selector and a declaration block
+	QualifiedRule RuleKind = iota
+	// AtRule is a rule starting with an `@` keyword
+	AtRule
+)
+
+// Rule represents a CSS qualified rule or at-rule
+type Rule struct {
+	Kind RuleKind
+
+	// Name is the at-rule keyword (eg. "@media"), empty for qualified rules
+	Name string
+
+	// Prelude is the raw text between the rule's introducer and its block
+	// (or terminating semicolon), kept for round-tripping
+	Prelude string
+
+	// Selectors holds the comma-separated selectors of a qualified rule, as
+	// raw, unparsed text
+	Selectors []string
+
+	// ParsedSelectors holds the structured form of Selectors, one entry per
+	// selector, in the same order. It is populated by the parser but not
+	// considered by Equal/Diff, which only compare the raw Selectors.
+	ParsedSelectors []*Selector
+
+	// Declarations holds the rule's own declarations, when its block is a
+	// declaration list (eg. a qualified rule, or `@font-face`)
+	Declarations []*Declaration
+
+	// Rules holds nested rules, when the at-rule's block embeds other rules
+	// (eg. `@media`, `@keyframes`, `@supports`). It is also populated on a
+	// QualifiedRule whose block nests further rules under the CSS Nesting
+	// Module, which Stylesheet.Flatten expands back into plain flat rules.
+	Rules []*Rule
+
+	// SupportsCondition holds the structured form of an `@supports`
+	// Prelude. It is nil for every other rule. Like ParsedSelectors, it is
+	// populated by the parser but ignored by Equal/Diff.
+	SupportsCondition *SupportsCondition
+
+	// HasBlock records whether the rule had a `{ ... }` block at all, as
+	// opposed to being terminated by a bare semicolon (eg. `@import "x";`).
+	// It is not considered by Equal/Diff, it only affects rendering.
+	HasBlock bool
+
+	// Line and Column give the rule's 1-based position in the input with its
+	// comments removed, so a comment earlier in the input shifts them from
+	// the original line and column. They are only populated by
+	// parser.ParseWithDiagnostics, and are ignored by Equal/Diff.
+	Line, Column int
+}
+
+// NewRule instanciates a new Rule
+func NewRule(kind RuleKind) *Rule {
+	return &Rule{Kind: kind}
+}
+
+// String returns the CSS string representation of the rule
+func (r *Rule) String() string {
+	return r.indentedString(0)
+}
+
+func (r *Rule) indentedString(level int) string {
+	indent := strings.Repeat("  ", level)
+
+	var head string
+	if r.Kind == AtRule {
+		if r.Prelude != "" {
+			head = r.Name + " " + r.Prelude
+		} else {
+			head = r.Name
+		}
+
+		if !r.HasBlock {
+			return indent + head + ";"
+		}
+	} else {
+		head = strings.Join(r.Selectors, ", ")
+	}
+
+	inner := strings.Repeat("  ", level+1)
+
+	var result strings.Builder
+	result.WriteString(indent + head + " {\n")
+
+	for _, decl := range r.Declarations {
+		result.WriteString(inner + decl.String() + "\n")
+	}
+
+	for _, nested := range r.Rules {
+		result.WriteString(nested.indentedString(level+1) + "\n")
+	}
+
+	result.WriteString(indent + "}")
+
+	return result.String()
+}
+
+// Equal returns true if both rules are structurally equivalent
+func (r *Rule) Equal(other *Rule) bool {
+	if other == nil {
+		return false
+	}
+
+	if r.Kind != other.Kind || r.Name != other.Name || r.Prelude != other.Prelude {
+		return false
+	}
+
+	if !equalStringSlices(r.Selectors, other.Selectors) {
+		return false
+	}
+
+	if len(r.Declarations) != len(other.Declarations) {
+		return false
+	}
+	for i, decl := range r.Declarations {
+		if !decl.Equal(other.Declarations[i]) {
+			return false
+		}
+	}
+
+	if len(r.Rules) != len(other.Rules) {
+		return false
+	}
+	for i, nested := range r.Rules {
+		if !nested.Equal(other.Rules[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Diff returns a human-readable list of differences between two rules, for
+// use in test failure messages
+func (r *Rule) Diff(other *Rule) []string {
+	var diffs []string
+
+	if other == nil {
+		return []string{"other rule is nil"}
+	}
+
+	if r.Kind != other.Kind {
+		diffs = append(diffs, fmt.Sprintf("Kind: %v != %v", r.Kind, other.Kind))
+	}
+	if r.Name != other.Name {
+		diffs = append(diffs, fmt.Sprintf("Name: %q != %q", r.Name, other.Name))
+	}
+	if r.Prelude != other.Prelude {
+		diffs = append(diffs, fmt.Sprintf("Prelude: %q != %q", r.Prelude, other.Prelude))
+	}
+	if !equalStringSlices(r.Selectors, other.Selectors) {
+		diffs = append(diffs, fmt.Sprintf("Selectors: %v != %v", r.Selectors, other.Selectors))
+	}
+
+	if len(r.Declarations) != len(other.Declarations) {
+		diffs = append(diffs, fmt.Sprintf("Declarations count: %d != %d", len(r.Declarations), len(other.Declarations)))
+	} else {
+		for i, decl := range r.Declarations {
+			if !decl.Equal(other.Declarations[i]) {
+				diffs = append(diffs, fmt.Sprintf("Declaration[%d]: %q != %q", i, decl.String(), other.Declarations[i].String()))
+			}
+		}
+	}
+
+	if len(r.Rules) != len(other.Rules) {
+		diffs = append(diffs, fmt.Sprintf("Rules count: %d != %d", len(r.Rules), len(other.Rules)))
+	} else {
+		for i, nested := range r.Rules {
+			diffs = append(diffs, nested.Diff(other.Rules[i])...)
+		}
+	}
+
+	return diffs
+}
+
+func equalStringSlices(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, v := range a {
+		if v != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,191 @@
+package css
+
+import "strings"
+
+// Combinator describes how a CompoundSelector relates to the compound
+// selector that precedes it inside a Selector
+type Combinator int
+
+const (
+	// Descendant is the implicit whitespace combinator (`a b`)
+	Descendant Combinator = iota
+	// Child is the `>` combinator
+	Child
+	// NextSibling is the `+` combinator
+	NextSibling
+	// SubsequentSibling is the `~` combinator
+	SubsequentSibling
+)
+
+// String returns the CSS token for the combinator
+func (c Combinator) String() string {
+	switch c {
+	case Child:
+		return ">"
+	case NextSibling:
+		return "+"
+	case SubsequentSibling:
+		return "~"
+	default:
+		return ""
+	}
+}
+
+// SimpleSelectorKind identifies the syntactic category of a SimpleSelector
+type SimpleSelectorKind int
+
+const (
+	// TypeSimpleSelector matches an element name, eg. `div`
+	TypeSimpleSelector SimpleSelectorKind = iota
+	// UniversalSimpleSelector matches `*`
+	UniversalSimpleSelector
+	// IDSimpleSelector matches `#id`
+	IDSimpleSelector
+	// ClassSimpleSelector matches `.class`
+	ClassSimpleSelector
+	// AttrSimpleSelector matches `[attr op value]`
+	AttrSimpleSelector
+	// PseudoClassSimpleSelector matches `:pseudo-class`, including the
+	// functional ones (`:not(...)`, `:nth-child(...)`, ...)
+	PseudoClassSimpleSelector
+	// PseudoElementSimpleSelector matches `::pseudo-element`
+	PseudoElementSimpleSelector
+	// NestingSimpleSelector matches `&`, the CSS Nesting Module's reference
+	// to the enclosing rule's selector. It is only ever resolved by
+	// Stylesheet.Flatten, which substitutes it with the parent selector(s)
+	// at the raw-text level rather than in this parsed form.
+	NestingSimpleSelector
+)
+
+// SimpleSelector is a single simple selector, eg. `div`, `#id`, `.class`,
+// `[attr=value]`, `:hover` or `::before`
+type SimpleSelector struct {
+	Kind SimpleSelectorKind
+
+	// Namespace is the `ns` part of a `ns|name` prefixed type/universal/attr
+	// selector. "*" means "any namespace", "" means "no namespace prefix".
+	Namespace string
+
+	// Value is the element name, id, class name or pseudo name (without its
+	// leading `#`, `.`, `:` or `::`)
+	Value string
+
+	// AttrOp is the attribute operator of an AttrSimpleSelector: "", "=",
+	// "~=", "|=", "^=", "$=" or "*="
+	AttrOp string
+	// AttrValue is the (unquoted) value of an AttrSimpleSelector
+	AttrValue string
+	// AttrCaseInsensitive records a trailing `i` flag on an attribute
+	// selector, eg. `[type=text i]`
+	AttrCaseInsensitive bool
+
+	// Args holds the parsed argument of a functional pseudo-class that takes
+	// a selector list, eg. `:not(a, b.c)` or `:is(...)`
+	Args []*Selector
+
+	// NthA and NthB hold the parsed `An+B` argument of a functional
+	// pseudo-class such as `:nth-child(2n+1)`. Both are zero when the
+	// pseudo-class isn't an An+B one, or it couldn't be parsed.
+	NthA, NthB int
+	// HasNth records whether NthA/NthB were successfully parsed
+	HasNth bool
+
+	// Raw is the argument text of a functional pseudo-class, verbatim,
+	// for round-tripping and for forms not otherwise modeled above
+	Raw string
+}
+
+// CompoundSelector is a sequence of simple selectors with no combinator
+// between them (eg. `div.warning#id`), reached through Combinator from the
+// previous compound selector in the Selector
+type CompoundSelector struct {
+	Combinator Combinator
+	Simples    []*SimpleSelector
+}
+
+// Specificity is the (a, b, c) specificity triple of a selector, as defined
+// by the CSS Selectors spec: a counts ID selectors, b counts classes,
+// attributes and pseudo-classes, c counts type selectors and
+// pseudo-elements
+type Specificity struct {
+	A, B, C int
+}
+
+// Add returns the term-wise sum of two specificities
+func (s Specificity) Add(other Specificity) Specificity {
+	return Specificity{A: s.A + other.A, B: s.B + other.B, C: s.C + other.C}
+}
+
+// Less reports whether s is strictly less specific than other
+func (s Specificity) Less(other Specificity) bool {
+	if s.A != other.A {
+		return s.A < other.A
+	}
+	if s.B != other.B {
+		return s.B < other.B
+	}
+	return s.C < other.C
+}
+
+// Selector is a single complex selector, ie. one comma-separated member of a
+// qualified rule's prelude, eg. `div > p.intro:first-child`
+type Selector struct {
+	// Raw is the original selector text, kept for round-tripping
+	Raw string
+
+	// Compounds is the sequence of compound selectors making up the complex
+	// selector, in source order. The first one always has Descendant as its
+	// Combinator (there being nothing before it).
+	Compounds []*CompoundSelector
+}
+
+// String returns Raw, the original selector text
+func (s *Selector) String() string {
+	return s.Raw
+}
+
+// Specificity computes the selector's (a, b, c) specificity
+func (s *Selector) Specificity() Specificity {
+	var total Specificity
+
+	for _, compound := range s.Compounds {
+		for _, simple := range compound.Simples {
+			total = total.Add(simple.specificity())
+		}
+	}
+
+	return total
+}
+
+func (s *SimpleSelector) specificity() Specificity {
+	switch s.Kind {
+	case IDSimpleSelector:
+		return Specificity{A: 1}
+	case ClassSimpleSelector, AttrSimpleSelector:
+		return Specificity{B: 1}
+	case TypeSimpleSelector:
+		return Specificity{C: 1}
+	case PseudoElementSimpleSelector:
+		return Specificity{C: 1}
+	case PseudoClassSimpleSelector:
+		switch strings.ToLower(s.Value) {
+		case "where":
+			// :where() is specifically defined to contribute zero
+			return Specificity{}
+		case "not", "is", "has":
+			// these take the specificity of their most specific argument
+			var max Specificity
+			for _, arg := range s.Args {
+				sp := arg.Specificity()
+				if max.Less(sp) {
+					max = sp
+				}
+			}
+			return max
+		default:
+			return Specificity{B: 1}
+		}
+	default: // UniversalSimpleSelector and NestingSimpleSelector contribute nothing
+		return Specificity{}
+	}
+}
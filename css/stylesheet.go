@@ -0,0 +1,25 @@
+package css
+
+import "strings"
+
+// Stylesheet represents a parsed CSS stylesheet, as a flat list of top-level
+// rules (qualified rules and at-rules)
+type Stylesheet struct {
+	Rules []*Rule
+}
+
+// NewStylesheet instanciates a new Stylesheet
+func NewStylesheet() *Stylesheet {
+	return &Stylesheet{}
+}
+
+// String returns the CSS string representation of the stylesheet
+func (s *Stylesheet) String() string {
+	rules := make([]string, len(s.Rules))
+
+	for i, rule := range s.Rules {
+		rules[i] = rule.String()
+	}
+
+	return strings.Join(rules, "\n")
+}
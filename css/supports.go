@@ -0,0 +1,99 @@
+package css
+
+// SupportsConditionKind identifies the syntactic form of a SupportsCondition
+type SupportsConditionKind int
+
+const (
+	// SupportsFeature is a feature-query leaf, eg. `(animation-name: test)`
+	SupportsFeature SupportsConditionKind = iota
+	// SupportsSelectorFunc is a `selector(...)` leaf
+	SupportsSelectorFunc
+	// SupportsNot is `not <condition>`
+	SupportsNot
+	// SupportsAnd is `<condition> and <condition> (and <condition>)*`
+	SupportsAnd
+	// SupportsOr is `<condition> or <condition> (or <condition>)*`
+	SupportsOr
+)
+
+// SupportsCondition is the parsed form of an `@supports` prelude
+type SupportsCondition struct {
+	Kind SupportsConditionKind
+
+	// Property and Value are set for a SupportsFeature leaf
+	Property string
+	Value    string
+
+	// Selector is set for a SupportsSelectorFunc leaf
+	Selector *Selector
+
+	// Operands holds the sub-conditions of a SupportsNot (always length 1),
+	// SupportsAnd or SupportsOr node
+	Operands []*SupportsCondition
+
+	// Raw is the condition's original text, when available, for
+	// round-tripping and for leaves not otherwise modeled above
+	Raw string
+}
+
+// SupportsCapabilities lets a caller describe what the target renderer
+// actually supports, so that EvaluateSupports can statically resolve
+// `@supports` conditions
+type SupportsCapabilities struct {
+	// SupportsDeclaration reports whether the renderer supports the given
+	// property/value pair. If nil, every feature query evaluates to true.
+	SupportsDeclaration func(property, value string) bool
+
+	// SupportsSelectorSyntax reports whether the renderer's selector engine
+	// understands the given selector. If nil, every `selector(...)` query
+	// evaluates to true.
+	SupportsSelectorSyntax func(selector *Selector) bool
+}
+
+// EvaluateSupports evaluates the rule's SupportsCondition (set when Name is
+// "@supports") against the given capabilities. It returns false for a rule
+// that isn't an `@supports` rule, or whose prelude failed to parse.
+func (r *Rule) EvaluateSupports(caps SupportsCapabilities) bool {
+	if r.SupportsCondition == nil {
+		return false
+	}
+	return r.SupportsCondition.evaluate(caps)
+}
+
+func (c *SupportsCondition) evaluate(caps SupportsCapabilities) bool {
+	switch c.Kind {
+	case SupportsFeature:
+		if caps.SupportsDeclaration == nil {
+			return true
+		}
+		return caps.SupportsDeclaration(c.Property, c.Value)
+
+	case SupportsSelectorFunc:
+		if caps.SupportsSelectorSyntax == nil {
+			return true
+		}
+		return caps.SupportsSelectorSyntax(c.Selector)
+
+	case SupportsNot:
+		return !c.Operands[0].evaluate(caps)
+
+	case SupportsAnd:
+		for _, op := range c.Operands {
+			if !op.evaluate(caps) {
+				return false
+			}
+		}
+		return true
+
+	case SupportsOr:
+		for _, op := range c.Operands {
+			if op.evaluate(caps) {
+				return true
+			}
+		}
+		return false
+
+	default:
+		return false
+	}
+}
@@ -0,0 +1,211 @@
+package css
+
+import "strings"
+
+// VarRef is a single `var(--name[, fallback])` call found in a
+// Declaration's Value
+type VarRef struct {
+	// Name is the referenced custom property, eg. "--emph"
+	Name string
+	// Fallback is the raw, unresolved fallback text, empty if none was given
+	Fallback string
+	// Raw is the exact `var(...)` substring this VarRef was parsed from,
+	// used by ResolveVars to substitute it back into Value
+	Raw string
+}
+
+// VarDiagnostic reports a `var()` reference that ResolveVars could not
+// resolve, because no custom property of that name is visible to the
+// declaration (it was never declared, or only by rules that don't scope into
+// the declaration's rule) and no fallback was given
+type VarDiagnostic struct {
+	// Property is the declaration the unresolved var() was found in
+	Property string
+	// Name is the custom property that couldn't be resolved
+	Name string
+}
+
+// customPropsScope records the custom properties a single qualified rule
+// declares, along with enough of its selectors to tell which other rules
+// they are visible to
+type customPropsScope struct {
+	selectors []*Selector
+	props     map[string]string
+}
+
+// ResolveVars walks the stylesheet's rules in cascade (source) order and
+// substitutes every `var(...)` reference in every declaration with its
+// resolved value. A custom property is visible to a declaration if it was
+// declared by an enclosing rule (CSS Nesting), or by any earlier rule whose
+// selector scopes into the declaration's rule, including one outside an
+// enclosing at-rule such as `@media` (eg. `.dark`'s properties reach
+// `.dark p`, but not `.light p`) — the best approximation of the cascade
+// available without a real DOM to match selectors against. Properties
+// declared by a later rule are not visible. A reference whose custom
+// property is not visible to it, and which has no fallback, is left
+// untouched and reported.
+func (s *Stylesheet) ResolveVars() []VarDiagnostic {
+	var diags []VarDiagnostic
+	resolveVarsLevel(s.Rules, map[string]string{}, nil, &diags)
+	return diags
+}
+
+// resolveVarsLevel resolves var() references for one slice of sibling
+// rules, inheriting parentEnv from the enclosing rule (if any) and
+// outerScopes, the scopes of the earlier rules at enclosing levels. Custom
+// properties declared by a rule at this level are visible to its own
+// declarations, to nested rules (lexical, CSS Nesting scoping), and to any
+// later rule, at this level or nested in a later sibling, whose selector
+// this rule's selector scopes into; they are not visible to earlier
+// siblings or to unrelated selectors.
+func resolveVarsLevel(rules []*Rule, parentEnv map[string]string, outerScopes []customPropsScope, diags *[]VarDiagnostic) {
+	scopes := append([]customPropsScope(nil), outerScopes...)
+
+	for _, rule := range rules {
+		env := parentEnv
+		if rule.Kind == QualifiedRule {
+			env = scopedEnv(parentEnv, scopes, rule.ParsedSelectors)
+		}
+
+		own := map[string]string{}
+		for _, decl := range rule.Declarations {
+			if strings.HasPrefix(decl.Property, "--") {
+				own[decl.Property] = decl.Value
+			}
+		}
+		if len(own) > 0 {
+			env = overlayEnv(env, own)
+		}
+
+		for _, decl := range rule.Declarations {
+			for _, ref := range decl.VarRefs {
+				resolved, ok := env[ref.Name]
+				if !ok {
+					if ref.Fallback != "" {
+						resolved = ref.Fallback
+					} else {
+						*diags = append(*diags, VarDiagnostic{Property: decl.Property, Name: ref.Name})
+						continue
+					}
+				}
+				decl.Value = strings.Replace(decl.Value, ref.Raw, resolved, 1)
+			}
+		}
+
+		if rule.Kind == QualifiedRule && len(own) > 0 {
+			scopes = append(scopes, customPropsScope{selectors: rule.ParsedSelectors, props: own})
+		}
+
+		resolveVarsLevel(rule.Rules, env, scopes, diags)
+	}
+}
+
+// scopedEnv builds the custom-property environment visible to a qualified
+// rule with the given selectors: parentEnv (always visible, lexical
+// nesting), overlaid with every earlier sibling scope whose selector
+// scopes into selectors
+func scopedEnv(parentEnv map[string]string, scopes []customPropsScope, selectors []*Selector) map[string]string {
+	env := parentEnv
+
+	for _, scope := range scopes {
+		if selectorsScope(scope.selectors, selectors) {
+			env = overlayEnv(env, scope.props)
+		}
+	}
+
+	return env
+}
+
+// overlayEnv returns a new map holding base's entries overlaid with extra's,
+// leaving both untouched
+func overlayEnv(base, extra map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(extra))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range extra {
+		merged[k] = v
+	}
+	return merged
+}
+
+// selectorsScope reports whether any of declaring's selectors scopes into
+// any of target's, ie. whether a rule matching one of declaring also
+// matches (or is an ancestor of what matches) one of target
+func selectorsScope(declaring, target []*Selector) bool {
+	for _, d := range declaring {
+		for _, t := range target {
+			if compoundsContain(t.Compounds, d.Compounds) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compoundsContain reports whether needle appears as a contiguous, in-order
+// run within haystack, comparing compound selectors by their simple
+// selectors rather than by combinator. This approximates "haystack matches
+// an element inside (or equal to) what needle matches", without a real DOM
+// to test actual ancestry against
+func compoundsContain(haystack, needle []*CompoundSelector) bool {
+	if len(needle) == 0 || len(haystack) == 0 {
+		return false
+	}
+
+	// `:root` always matches the document's root element, the ancestor of
+	// everything else, so its custom properties are visible everywhere
+	if isDocumentRoot(needle) {
+		return true
+	}
+
+	if len(needle) > len(haystack) {
+		return false
+	}
+
+	for start := 0; start+len(needle) <= len(haystack); start++ {
+		match := true
+		for i, n := range needle {
+			if !sameSimples(haystack[start+i].Simples, n.Simples) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isDocumentRoot reports whether needle is a single `:root` compound
+// selector
+func isDocumentRoot(needle []*CompoundSelector) bool {
+	if len(needle) != 1 || len(needle[0].Simples) == 0 {
+		return false
+	}
+	for _, s := range needle[0].Simples {
+		if s.Kind != PseudoClassSimpleSelector || strings.ToLower(s.Value) != "root" {
+			return false
+		}
+	}
+	return true
+}
+
+// sameSimples reports whether two compound selectors' simple selectors are
+// equivalent
+func sameSimples(a, b []*SimpleSelector) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, s := range a {
+		o := b[i]
+		if s.Kind != o.Kind || s.Namespace != o.Namespace || s.Value != o.Value ||
+			s.AttrOp != o.AttrOp || s.AttrValue != o.AttrValue ||
+			s.AttrCaseInsensitive != o.AttrCaseInsensitive || s.Raw != o.Raw {
+			return false
+		}
+	}
+	return true
+}
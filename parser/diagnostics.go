@@ -0,0 +1,336 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Polymail/douceur/css"
+)
+
+// Severity classifies how serious a Diagnostic is
+type Severity int
+
+const (
+	// SeverityWarning is a recoverable issue: parsing continued past it
+	SeverityWarning Severity = iota
+	// SeverityError is an issue parsing could not recover from, ending the
+	// parse of the rule list it occurred in
+	SeverityError
+)
+
+// String returns "warning" or "error"
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// Diagnostic describes a single issue found while parsing, with enough
+// source position information to point a user at it
+type Diagnostic struct {
+	// Line and Column are 1-based, counted like Offset in the text after
+	// comment stripping, so a comment earlier in the input shifts them from
+	// the original line and column
+	Line, Column int
+	// Offset and Length are 0-based byte offsets into the text passed to
+	// ParseWithDiagnostics, after comment stripping
+	Offset, Length int
+
+	Severity Severity
+	Message  string
+
+	// RuleContext names the enclosing rule (eg. a selector or an at-rule's
+	// name and prelude), empty at the top level of the stylesheet
+	RuleContext string
+}
+
+// ParseWithDiagnostics parses a whole CSS stylesheet like Parse, but instead
+// of aborting on the first recoverable error (an unparseable declaration, a
+// selector with no declaration block, ...), it records a Diagnostic for
+// each one and keeps going. Every returned *css.Rule and *css.Declaration
+// has its Line/Column populated. The returned error is non-nil only for
+// unrecoverable issues (eg. an unterminated string or block), in which case
+// the returned stylesheet and diagnostics still hold everything parsed
+// before that point.
+func ParseWithDiagnostics(input string) (*css.Stylesheet, []Diagnostic, error) {
+	text := stripComments(input)
+
+	d := &diagnosticParser{text: text}
+	rules, err := d.parseRules(0, len(text), "")
+
+	return &css.Stylesheet{Rules: rules}, d.diagnostics, err
+}
+
+type diagnosticParser struct {
+	text        string
+	diagnostics []Diagnostic
+}
+
+func (d *diagnosticParser) warn(offset, length int, context, message string) {
+	d.report(SeverityWarning, offset, length, context, message)
+}
+
+func (d *diagnosticParser) report(severity Severity, offset, length int, context, message string) {
+	line, column := offsetToLineColumn(d.text, offset)
+	d.diagnostics = append(d.diagnostics, Diagnostic{
+		Line: line, Column: column, Offset: offset, Length: length,
+		Severity: severity, Message: message, RuleContext: context,
+	})
+}
+
+// parseRules parses every top-level rule in text[start:end], recording a
+// Diagnostic for each recoverable issue instead of failing outright
+func (d *diagnosticParser) parseRules(start, end int, context string) ([]*css.Rule, error) {
+	var rules []*css.Rule
+	text := d.text
+
+	for i := start; i < end; {
+		for i < end && isSpace(text[i]) {
+			i++
+		}
+		if i >= end {
+			break
+		}
+
+		preludeStart := i
+		stmtEnd, terminator, err := scanStatement(text[:end], i)
+		if err != nil {
+			d.report(SeverityError, i, end-i, context, err.Error())
+			return rules, err
+		}
+
+		prelude := strings.TrimSpace(text[preludeStart:stmtEnd])
+		line, column := offsetToLineColumn(text, preludeStart)
+
+		switch terminator {
+		case ';':
+			i = stmtEnd + 1
+
+			if prelude == "" {
+				continue
+			}
+
+			if strings.HasPrefix(prelude, "@") {
+				name, rest := splitAtRuleName(prelude)
+				rules = append(rules, &css.Rule{
+					Kind: css.AtRule, Name: name, Prelude: rest,
+					Line: line, Column: column,
+				})
+			} else {
+				d.warn(preludeStart, stmtEnd-preludeStart, context,
+					fmt.Sprintf("selector %q has no declaration block", prelude))
+			}
+
+		case '{':
+			blockEnd, err := matchBrace(text[:end], stmtEnd)
+			if err != nil {
+				d.report(SeverityError, stmtEnd, end-stmtEnd, context, err.Error())
+				return rules, err
+			}
+			i = blockEnd + 1
+
+			if prelude == "" {
+				continue
+			}
+
+			if strings.HasPrefix(prelude, "@") {
+				name, rest := splitAtRuleName(prelude)
+				rule := &css.Rule{
+					Kind: css.AtRule, Name: name, Prelude: rest, HasBlock: true,
+					Line: line, Column: column,
+				}
+
+				ruleContext := strings.TrimSpace(name + " " + rest)
+
+				if hasTopLevelBlock(text[stmtEnd+1 : blockEnd]) {
+					nested, err := d.parseRules(stmtEnd+1, blockEnd, ruleContext)
+					rule.Rules = nested
+					if err != nil {
+						rules = append(rules, rule)
+						return rules, err
+					}
+				} else {
+					rule.Declarations = d.parseDeclarations(stmtEnd+1, blockEnd, ruleContext)
+				}
+
+				attachSupportsCondition(rule)
+
+				rules = append(rules, rule)
+			} else {
+				parsedSelectors, err := ParseSelectorList(prelude)
+				if err != nil {
+					d.warn(preludeStart, len(prelude), context, err.Error())
+				}
+
+				rule := &css.Rule{
+					Kind: css.QualifiedRule, Prelude: prelude, Selectors: splitSelectors(prelude),
+					ParsedSelectors: parsedSelectors, HasBlock: true,
+					Line: line, Column: column,
+				}
+
+				if hasTopLevelBlock(text[stmtEnd+1 : blockEnd]) {
+					// the CSS Nesting Module: this qualified rule's block embeds
+					// further rules (possibly using `&`) alongside declarations,
+					// the same grammar parseMixedBody recognizes for Parse
+					decls, nested := d.parseMixedBody(stmtEnd+1, blockEnd, prelude)
+					rule.Declarations = decls
+					rule.Rules = nested
+				} else {
+					rule.Declarations = d.parseDeclarations(stmtEnd+1, blockEnd, prelude)
+				}
+
+				rules = append(rules, rule)
+			}
+
+		default: // EOF with no terminator: stray trailing text
+			if prelude != "" {
+				d.warn(preludeStart, end-preludeStart, context, "unexpected trailing text, ignored")
+			}
+			i = end
+		}
+	}
+
+	return rules, nil
+}
+
+// parseDeclarations parses the declaration list in text[start:end],
+// recording a Diagnostic for each malformed declaration instead of
+// dropping it silently
+func (d *diagnosticParser) parseDeclarations(start, end int, context string) []*css.Declaration {
+	var decls []*css.Declaration
+	block := d.text[start:end]
+
+	for _, s := range splitTopLevelSpans(block, ';') {
+		raw := block[s.start:s.end]
+		stmt := strings.TrimSpace(raw)
+		if stmt == "" {
+			continue
+		}
+		stmtStart := start + s.start + strings.Index(raw, stmt)
+
+		decl, ok := parseDeclarationStmt(stmt)
+		if !ok {
+			d.warn(stmtStart, s.end-s.start, context, fmt.Sprintf("malformed declaration: %q", stmt))
+			continue
+		}
+
+		decl.Line, decl.Column = offsetToLineColumn(d.text, stmtStart)
+		decls = append(decls, decl)
+	}
+
+	return decls
+}
+
+// parseMixedBody parses the content of a qualified rule's block in
+// text[start:end] under the CSS Nesting Module, where declarations and
+// further nested rules (other qualified rules, or at-rules such as
+// `@media`) may appear side by side. It mirrors parseMixedBody's grammar,
+// recording a Diagnostic for each recoverable issue instead of failing
+// outright
+func (d *diagnosticParser) parseMixedBody(start, end int, context string) ([]*css.Declaration, []*css.Rule) {
+	var decls []*css.Declaration
+	var rules []*css.Rule
+	text := d.text
+
+	for i := start; i < end; {
+		for i < end && isSpace(text[i]) {
+			i++
+		}
+		if i >= end {
+			break
+		}
+
+		preludeStart := i
+		stmtEnd, terminator, err := scanStatement(text[:end], i)
+		if err != nil {
+			d.report(SeverityError, i, end-i, context, err.Error())
+			return decls, rules
+		}
+
+		prelude := strings.TrimSpace(text[preludeStart:stmtEnd])
+		line, column := offsetToLineColumn(text, preludeStart)
+
+		switch terminator {
+		case ';':
+			i = stmtEnd + 1
+
+			if prelude == "" {
+				continue
+			}
+
+			decl, ok := parseDeclarationStmt(prelude)
+			if !ok {
+				d.warn(preludeStart, stmtEnd-preludeStart, context, fmt.Sprintf("malformed declaration: %q", prelude))
+				continue
+			}
+			decl.Line, decl.Column = line, column
+			decls = append(decls, decl)
+
+		case '{':
+			blockEnd, err := matchBrace(text[:end], stmtEnd)
+			if err != nil {
+				d.report(SeverityError, stmtEnd, end-stmtEnd, context, err.Error())
+				return decls, rules
+			}
+			i = blockEnd + 1
+
+			if prelude == "" {
+				continue
+			}
+
+			if strings.HasPrefix(prelude, "@") {
+				name, rest := splitAtRuleName(prelude)
+				rule := &css.Rule{
+					Kind: css.AtRule, Name: name, Prelude: rest, HasBlock: true,
+					Line: line, Column: column,
+				}
+
+				ruleContext := strings.TrimSpace(name + " " + rest)
+				rule.Declarations, rule.Rules = d.parseMixedBody(stmtEnd+1, blockEnd, ruleContext)
+
+				attachSupportsCondition(rule)
+
+				rules = append(rules, rule)
+				continue
+			}
+
+			parsedSelectors, err := ParseSelectorList(prelude)
+			if err != nil {
+				d.warn(preludeStart, len(prelude), context, err.Error())
+			}
+
+			nestedDecls, nestedRules := d.parseMixedBody(stmtEnd+1, blockEnd, prelude)
+
+			rules = append(rules, &css.Rule{
+				Kind: css.QualifiedRule, Prelude: prelude, Selectors: splitSelectors(prelude),
+				ParsedSelectors: parsedSelectors, Declarations: nestedDecls, Rules: nestedRules, HasBlock: true,
+				Line: line, Column: column,
+			})
+
+		default: // EOF with no terminator: stray trailing text
+			if prelude != "" {
+				d.warn(preludeStart, end-preludeStart, context, "unexpected trailing text, ignored")
+			}
+			i = end
+		}
+	}
+
+	return decls, rules
+}
+
+// offsetToLineColumn converts a 0-based byte offset into text to a 1-based
+// (line, column) pair
+func offsetToLineColumn(text string, offset int) (line, column int) {
+	line = 1
+	lineStart := 0
+
+	for i := 0; i < offset && i < len(text); i++ {
+		if text[i] == '\n' {
+			line++
+			lineStart = i + 1
+		}
+	}
+
+	return line, offset - lineStart + 1
+}
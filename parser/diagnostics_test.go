@@ -0,0 +1,100 @@
+package parser
+
+import "testing"
+
+func TestParseWithDiagnosticsRecovers(t *testing.T) {
+	input := "p; div > p; div { background-color: yellow };"
+
+	stylesheet, diags, err := ParseWithDiagnostics(input)
+	if err != nil {
+		t.Fatalf("unexpected fatal error: %v", err)
+	}
+
+	if len(stylesheet.Rules) != 1 || stylesheet.Rules[0].Prelude != "div" {
+		t.Fatalf("unexpected rules: %+v", stylesheet.Rules)
+	}
+
+	if len(diags) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %d: %+v", len(diags), diags)
+	}
+	for _, diag := range diags {
+		if diag.Severity != SeverityWarning {
+			t.Fatalf("expected a warning, got %+v", diag)
+		}
+	}
+}
+
+func TestParseWithDiagnosticsMalformedDeclaration(t *testing.T) {
+	input := "div {\n  color red;\n  background: yellow;\n}"
+
+	stylesheet, diags, err := ParseWithDiagnostics(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decls := stylesheet.Rules[0].Declarations
+	if len(decls) != 1 || decls[0].Property != "background" {
+		t.Fatalf("unexpected declarations: %+v", decls)
+	}
+
+	if len(diags) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %d: %+v", len(diags), diags)
+	}
+	if diags[0].Line != 2 {
+		t.Fatalf("expected the diagnostic on line 2, got line %d", diags[0].Line)
+	}
+}
+
+func TestParseWithDiagnosticsPositions(t *testing.T) {
+	input := "div {\n  color: red;\n}"
+
+	stylesheet, _, err := ParseWithDiagnostics(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rule := stylesheet.Rules[0]
+	if rule.Line != 1 || rule.Column != 1 {
+		t.Fatalf("unexpected rule position: line %d column %d", rule.Line, rule.Column)
+	}
+
+	decl := rule.Declarations[0]
+	if decl.Line != 2 {
+		t.Fatalf("expected declaration on line 2, got line %d", decl.Line)
+	}
+}
+
+func TestParseWithDiagnosticsUnterminatedBlock(t *testing.T) {
+	input := "div { color: red;"
+
+	_, diags, err := ParseWithDiagnostics(input)
+	if err == nil {
+		t.Fatal("expected a fatal error for an unterminated block")
+	}
+	if len(diags) != 1 || diags[0].Severity != SeverityError {
+		t.Fatalf("expected a single error diagnostic, got %+v", diags)
+	}
+}
+
+func TestParseWithDiagnosticsNestedRule(t *testing.T) {
+	input := ".card {\n  color: red;\n  &:hover {\n    color: blue;\n  }\n}"
+
+	stylesheet, diags, err := ParseWithDiagnostics(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 0 {
+		t.Fatalf("expected no diagnostics, got %+v", diags)
+	}
+
+	rule := stylesheet.Rules[0]
+	if len(rule.Declarations) != 1 || rule.Declarations[0].Property != "color" || rule.Declarations[0].Value != "red" {
+		t.Fatalf("unexpected declarations: %+v", rule.Declarations)
+	}
+	if len(rule.Rules) != 1 || rule.Rules[0].Prelude != "&:hover" {
+		t.Fatalf("expected 1 nested rule for &:hover, got %+v", rule.Rules)
+	}
+	if rule.Rules[0].Declarations[0].Value != "blue" {
+		t.Fatalf("unexpected nested rule declarations: %+v", rule.Rules[0].Declarations)
+	}
+}
@@ -0,0 +1,31 @@
+package parser
+
+import "github.com/Polymail/douceur/css"
+
+// Iterator parses top-level rules one at a time, without retaining
+// previously emitted ones. It is meant for large or concatenated
+// stylesheets (eg. many `<style>` blocks pulled out of a MIME multipart
+// email) where holding the whole *css.Stylesheet in memory isn't needed.
+type Iterator struct {
+	text string
+	pos  int
+}
+
+// NewIterator creates an Iterator over text
+func NewIterator(text string) *Iterator {
+	return &Iterator{text: stripComments(text)}
+}
+
+// Next returns the next top-level rule, or (nil, nil) once the input is
+// exhausted. A parse error aborts iteration; subsequent calls keep
+// returning that same error.
+func (it *Iterator) Next() (*css.Rule, error) {
+	rule, next, err := parseNextRule(it.text, it.pos)
+	if err != nil {
+		return nil, err
+	}
+
+	it.pos = next
+
+	return rule, nil
+}
@@ -0,0 +1,62 @@
+package parser
+
+import "testing"
+
+func TestIterator(t *testing.T) {
+	text := `@charset "UTF-8";
+div { color: red; }
+p { color: blue; }`
+
+	it := NewIterator(text)
+
+	var preludes []string
+	for {
+		rule, err := it.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rule == nil {
+			break
+		}
+		preludes = append(preludes, rule.Name+rule.Prelude)
+	}
+
+	expected := []string{`@charset"UTF-8"`, "div", "p"}
+	if len(preludes) != len(expected) {
+		t.Fatalf("expected %d rules, got %d: %v", len(expected), len(preludes), preludes)
+	}
+}
+
+func TestIteratorMatchesParse(t *testing.T) {
+	text := `@media screen {
+  body { line-height: 1.2 }
+}
+a { color: red; }`
+
+	stylesheet, err := Parse(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	it := NewIterator(text)
+	var fromIterator []string
+	for {
+		rule, err := it.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rule == nil {
+			break
+		}
+		fromIterator = append(fromIterator, rule.String())
+	}
+
+	if len(fromIterator) != len(stylesheet.Rules) {
+		t.Fatalf("expected %d rules from iterator, got %d", len(stylesheet.Rules), len(fromIterator))
+	}
+	for i, rule := range stylesheet.Rules {
+		if rule.String() != fromIterator[i] {
+			t.Fatalf("rule %d mismatch:\n%s\nvs\n%s", i, rule.String(), fromIterator[i])
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package parser
+
+import "strings"
+
+// TokenKind identifies the syntactic category of a Token
+type TokenKind int
+
+const (
+	// EOFToken marks the end of input
+	EOFToken TokenKind = iota
+	// AtKeywordToken is `@` followed by an identifier, eg. `@media`
+	AtKeywordToken
+	// IdentToken is a bare identifier, eg. `div` or `red`
+	IdentToken
+	// StringToken is a single- or double-quoted string, quotes included
+	StringToken
+	// FunctionToken is an identifier immediately followed by `(`, eg. the
+	// `rgba` in `rgba(0, 0, 0, .5)`. Value holds the name, without the `(`.
+	FunctionToken
+	// DelimToken is any other single significant character (`,`, `:`, `>`,
+	// `(`, `)`, `[`, `]`, ...)
+	DelimToken
+	// SemicolonToken is `;`
+	SemicolonToken
+	// LBraceToken is `{`
+	LBraceToken
+	// RBraceToken is `}`
+	RBraceToken
+	// WhitespaceToken is a run of one or more whitespace characters
+	WhitespaceToken
+	// CommentToken is a `/* ... */` comment, delimiters included
+	CommentToken
+)
+
+// Token is a single lexical unit produced by the Lexer
+type Token struct {
+	Kind TokenKind
+	// Value is the token's text. For StringToken and CommentToken it
+	// includes the surrounding delimiters; for FunctionToken it is the
+	// function name, without the trailing `(`. For IdentToken and
+	// FunctionToken, backslash escapes are decoded (`a\.b` yields `a.b`).
+	Value string
+	// Pos is the token's starting byte offset in the Lexer's source text
+	Pos int
+}
+
+// Lexer tokenizes CSS source text one token at a time, without building an
+// AST, so that very large stylesheets can be processed without holding the
+// whole token stream in memory at once.
+type Lexer struct {
+	text string
+	pos  int
+}
+
+// NewLexer creates a Lexer over text
+func NewLexer(text string) *Lexer {
+	return &Lexer{text: text}
+}
+
+// Next returns the next token, or an EOFToken once the input is exhausted.
+// Calling Next again after an EOFToken keeps returning EOFToken.
+func (l *Lexer) Next() Token {
+	n := len(l.text)
+	if l.pos >= n {
+		return Token{Kind: EOFToken, Pos: l.pos}
+	}
+
+	start := l.pos
+	c := l.text[l.pos]
+
+	switch {
+	case isSpace(c):
+		for l.pos < n && isSpace(l.text[l.pos]) {
+			l.pos++
+		}
+		return Token{Kind: WhitespaceToken, Value: l.text[start:l.pos], Pos: start}
+
+	case c == '/' && l.pos+1 < n && l.text[l.pos+1] == '*':
+		if end := strings.Index(l.text[l.pos+2:], "*/"); end >= 0 {
+			l.pos += 2 + end + 2
+		} else {
+			l.pos = n
+		}
+		return Token{Kind: CommentToken, Value: l.text[start:l.pos], Pos: start}
+
+	case c == '"' || c == '\'':
+		l.pos++
+		for l.pos < n {
+			switch l.text[l.pos] {
+			case '\\':
+				l.pos += 2
+				continue
+			case c:
+				l.pos++
+				return Token{Kind: StringToken, Value: l.text[start:l.pos], Pos: start}
+			}
+			l.pos++
+		}
+		if l.pos > n {
+			// an escape as the very last byte (eg. `"ab\`) pushed pos past
+			// the end looking for the character it escapes
+			l.pos = n
+		}
+		return Token{Kind: StringToken, Value: l.text[start:l.pos], Pos: start}
+
+	case c == '@':
+		l.pos++
+		for l.pos < n && isIdentChar(l.text[l.pos]) {
+			l.pos++
+		}
+		return Token{Kind: AtKeywordToken, Value: l.text[start:l.pos], Pos: start}
+
+	case c == '{':
+		l.pos++
+		return Token{Kind: LBraceToken, Value: "{", Pos: start}
+
+	case c == '}':
+		l.pos++
+		return Token{Kind: RBraceToken, Value: "}", Pos: start}
+
+	case c == ';':
+		l.pos++
+		return Token{Kind: SemicolonToken, Value: ";", Pos: start}
+
+	case isIdentChar(c):
+		name, end := scanIdent(l.text, l.pos)
+		l.pos = end
+		if l.pos < n && l.text[l.pos] == '(' {
+			l.pos++
+			return Token{Kind: FunctionToken, Value: name, Pos: start}
+		}
+		return Token{Kind: IdentToken, Value: name, Pos: start}
+
+	default:
+		l.pos++
+		return Token{Kind: DelimToken, Value: string(c), Pos: start}
+	}
+}
@@ -0,0 +1,88 @@
+package parser
+
+import "testing"
+
+func TestLexerBasic(t *testing.T) {
+	lex := NewLexer(`@media screen { color: rgba(0, 0, 0, .5); }`)
+
+	expected := []struct {
+		Kind  TokenKind
+		Value string
+	}{
+		{AtKeywordToken, "@media"},
+		{WhitespaceToken, " "},
+		{IdentToken, "screen"},
+		{WhitespaceToken, " "},
+		{LBraceToken, "{"},
+		{WhitespaceToken, " "},
+		{IdentToken, "color"},
+		{DelimToken, ":"},
+		{WhitespaceToken, " "},
+		{FunctionToken, "rgba"},
+		{IdentToken, "0"},
+		{DelimToken, ","},
+		{WhitespaceToken, " "},
+		{IdentToken, "0"},
+		{DelimToken, ","},
+		{WhitespaceToken, " "},
+		{IdentToken, "0"},
+		{DelimToken, ","},
+		{WhitespaceToken, " "},
+		{DelimToken, "."},
+		{IdentToken, "5"},
+		{DelimToken, ")"},
+		{SemicolonToken, ";"},
+		{WhitespaceToken, " "},
+		{RBraceToken, "}"},
+	}
+
+	for i, want := range expected {
+		got := lex.Next()
+		if got.Kind != want.Kind || got.Value != want.Value {
+			t.Fatalf("token %d: expected {%v %q}, got {%v %q}", i, want.Kind, want.Value, got.Kind, got.Value)
+		}
+	}
+
+	if eof := lex.Next(); eof.Kind != EOFToken {
+		t.Fatalf("expected EOFToken, got %+v", eof)
+	}
+}
+
+func TestLexerStringsAndComments(t *testing.T) {
+	lex := NewLexer(`/* hi */ "a \"b\""`)
+
+	comment := lex.Next()
+	if comment.Kind != CommentToken || comment.Value != "/* hi */" {
+		t.Fatalf("unexpected comment token: %+v", comment)
+	}
+
+	_ = lex.Next() // whitespace
+
+	str := lex.Next()
+	if str.Kind != StringToken || str.Value != `"a \"b\""` {
+		t.Fatalf("unexpected string token: %+v", str)
+	}
+}
+
+func TestLexerUnterminatedStringTrailingEscape(t *testing.T) {
+	lex := NewLexer(`"ab\`)
+
+	str := lex.Next()
+	if str.Kind != StringToken || str.Value != `"ab\` {
+		t.Fatalf("unexpected string token: %+v", str)
+	}
+
+	if eof := lex.Next(); eof.Kind != EOFToken {
+		t.Fatalf("expected EOFToken, got %+v", eof)
+	}
+}
+
+func TestLexerEOFIsSticky(t *testing.T) {
+	lex := NewLexer("")
+
+	for i := 0; i < 3; i++ {
+		if got := lex.Next(); got.Kind != EOFToken {
+			t.Fatalf("call %d: expected EOFToken, got %+v", i, got)
+		}
+	}
+}
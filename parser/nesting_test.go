@@ -0,0 +1,150 @@
+package parser
+
+import "testing"
+
+func TestParseNestedPseudoClass(t *testing.T) {
+	stylesheet := MustParse(t, "a {\n  color: blue;\n  &:hover {\n    color: red;\n  }\n}", 1)
+
+	rule := stylesheet.Rules[0]
+	if len(rule.Declarations) != 1 || rule.Declarations[0].Property != "color" {
+		t.Fatalf("unexpected declarations: %+v", rule.Declarations)
+	}
+
+	if len(rule.Rules) != 1 {
+		t.Fatalf("expected 1 nested rule, got %+v", rule.Rules)
+	}
+	nested := rule.Rules[0]
+	if nested.Prelude != "&:hover" || nested.Declarations[0].Value != "red" {
+		t.Fatalf("unexpected nested rule: %+v", nested)
+	}
+}
+
+func TestParseNestedChildCombinator(t *testing.T) {
+	stylesheet := MustParse(t, "a {\n  & > .child {\n    color: red;\n  }\n}", 1)
+
+	nested := stylesheet.Rules[0].Rules[0]
+	if nested.Prelude != "& > .child" {
+		t.Fatalf("unexpected nested prelude: %q", nested.Prelude)
+	}
+}
+
+func TestParseNestedSibling(t *testing.T) {
+	stylesheet := MustParse(t, "a {\n  & + & {\n    color: red;\n  }\n}", 1)
+
+	nested := stylesheet.Rules[0].Rules[0]
+	if nested.Prelude != "& + &" {
+		t.Fatalf("unexpected nested prelude: %q", nested.Prelude)
+	}
+}
+
+func TestParseNestedMedia(t *testing.T) {
+	stylesheet := MustParse(t, "a {\n  color: blue;\n  @media (min-width: 100px) {\n    color: red;\n  }\n}", 1)
+
+	rule := stylesheet.Rules[0]
+	if len(rule.Rules) != 1 {
+		t.Fatalf("expected 1 nested rule, got %+v", rule.Rules)
+	}
+
+	media := rule.Rules[0]
+	if media.Name != "@media" || media.Prelude != "(min-width: 100px)" {
+		t.Fatalf("unexpected nested at-rule: %+v", media)
+	}
+	if len(media.Declarations) != 1 || media.Declarations[0].Value != "red" {
+		t.Fatalf("unexpected declarations on nested at-rule: %+v", media.Declarations)
+	}
+}
+
+func TestFlattenPseudoClass(t *testing.T) {
+	stylesheet := MustParse(t, "a {\n  color: blue;\n  &:hover {\n    color: red;\n  }\n}", 1)
+
+	flat := stylesheet.Flatten()
+	if len(flat.Rules) != 2 {
+		t.Fatalf("expected 2 flat rules, got %d: %+v", len(flat.Rules), flat.Rules)
+	}
+	if flat.Rules[0].Prelude != "a" || flat.Rules[0].Declarations[0].Value != "blue" {
+		t.Fatalf("unexpected first flat rule: %+v", flat.Rules[0])
+	}
+	if flat.Rules[1].Prelude != "a:hover" || flat.Rules[1].Declarations[0].Value != "red" {
+		t.Fatalf("unexpected second flat rule: %+v", flat.Rules[1])
+	}
+}
+
+func TestFlattenChildCombinator(t *testing.T) {
+	stylesheet := MustParse(t, "a {\n  & > .child {\n    color: red;\n  }\n}", 1)
+
+	flat := stylesheet.Flatten()
+	if len(flat.Rules) != 1 || flat.Rules[0].Prelude != "a > .child" {
+		t.Fatalf("unexpected flat rules: %+v", flat.Rules)
+	}
+}
+
+func TestFlattenSibling(t *testing.T) {
+	stylesheet := MustParse(t, "a {\n  & + & {\n    color: red;\n  }\n}", 1)
+
+	flat := stylesheet.Flatten()
+	if len(flat.Rules) != 1 || flat.Rules[0].Prelude != "a + a" {
+		t.Fatalf("unexpected flat rules: %+v", flat.Rules)
+	}
+}
+
+func TestFlattenCartesianProduct(t *testing.T) {
+	stylesheet := MustParse(t, "a, b {\n  &:hover, &:focus {\n    color: red;\n  }\n}", 1)
+
+	flat := stylesheet.Flatten()
+	if len(flat.Rules) != 1 {
+		t.Fatalf("expected 1 flat rule, got %+v", flat.Rules)
+	}
+
+	expected := []string{"a:hover", "b:hover", "a:focus", "b:focus"}
+	if len(flat.Rules[0].Selectors) != len(expected) {
+		t.Fatalf("expected selectors %v, got %v", expected, flat.Rules[0].Selectors)
+	}
+	for i, sel := range expected {
+		if flat.Rules[0].Selectors[i] != sel {
+			t.Fatalf("expected selectors %v, got %v", expected, flat.Rules[0].Selectors)
+		}
+	}
+}
+
+func TestFlattenMultiAmpersandCartesianProduct(t *testing.T) {
+	stylesheet := MustParse(t, "a, b {\n  & + & {\n    color: red;\n  }\n}", 1)
+
+	flat := stylesheet.Flatten()
+	if len(flat.Rules) != 1 {
+		t.Fatalf("expected 1 flat rule, got %+v", flat.Rules)
+	}
+
+	expected := []string{"a + a", "a + b", "b + a", "b + b"}
+	if len(flat.Rules[0].Selectors) != len(expected) {
+		t.Fatalf("expected selectors %v, got %v", expected, flat.Rules[0].Selectors)
+	}
+	for i, sel := range expected {
+		if flat.Rules[0].Selectors[i] != sel {
+			t.Fatalf("expected selectors %v, got %v", expected, flat.Rules[0].Selectors)
+		}
+	}
+}
+
+func TestFlattenHoistsNestedMedia(t *testing.T) {
+	stylesheet := MustParse(t, "a {\n  color: blue;\n  @media (min-width: 100px) {\n    color: red;\n  }\n}", 1)
+
+	flat := stylesheet.Flatten()
+	if len(flat.Rules) != 2 {
+		t.Fatalf("expected 2 flat rules, got %d: %+v", len(flat.Rules), flat.Rules)
+	}
+
+	if flat.Rules[0].Prelude != "a" {
+		t.Fatalf("unexpected first flat rule: %+v", flat.Rules[0])
+	}
+
+	media := flat.Rules[1]
+	if media.Name != "@media" || media.Prelude != "(min-width: 100px)" {
+		t.Fatalf("unexpected hoisted at-rule: %+v", media)
+	}
+	if len(media.Rules) != 1 || media.Rules[0].Prelude != "a" {
+		t.Fatalf("unexpected rule wrapped by hoisted at-rule: %+v", media.Rules)
+	}
+	if media.Rules[0].Declarations[0].Value != "red" {
+		t.Fatalf("unexpected declaration inside hoisted at-rule: %+v", media.Rules[0].Declarations)
+	}
+}
@@ -0,0 +1,586 @@
+// Package parser implements a lenient CSS3 parser, turning a stylesheet's
+// source text into a *css.Stylesheet.
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Polymail/douceur/css"
+)
+
+var importantRegexp = regexp.MustCompile(`(?i)!\s*important\s*$`)
+
+// Parse parses a whole CSS stylesheet
+func Parse(text string) (*css.Stylesheet, error) {
+	rules, err := parseRules(stripComments(text))
+	if err != nil {
+		return nil, err
+	}
+
+	return &css.Stylesheet{Rules: rules}, nil
+}
+
+// ParseDeclarations parses a standalone declaration block, ie. the content
+// of a `style` attribute, without its surrounding selector and braces
+func ParseDeclarations(text string) ([]*css.Declaration, error) {
+	return parseDeclarations(stripComments(text))
+}
+
+// parseRules parses a sequence of top-level rules out of already
+// comment-stripped text
+func parseRules(text string) ([]*css.Rule, error) {
+	var rules []*css.Rule
+
+	for i := 0; ; {
+		rule, next, err := parseNextRule(text, i)
+		if err != nil {
+			return nil, err
+		}
+		if rule == nil {
+			break
+		}
+
+		rules = append(rules, rule)
+		i = next
+	}
+
+	return rules, nil
+}
+
+// parseNextRule parses the next top-level rule out of already
+// comment-stripped text, starting at i. It returns a nil rule once there is
+// nothing left to parse. It is the shared core of parseRules and Iterator,
+// so that the latter never has to retain previously parsed rules.
+func parseNextRule(text string, i int) (*css.Rule, int, error) {
+	n := len(text)
+
+	for i < n {
+		for i < n && isSpace(text[i]) {
+			i++
+		}
+		if i >= n {
+			break
+		}
+
+		start := i
+		end, terminator, err := scanStatement(text, i)
+		if err != nil {
+			return nil, i, err
+		}
+
+		prelude := strings.TrimSpace(text[start:end])
+
+		switch terminator {
+		case ';':
+			i = end + 1
+
+			if prelude == "" {
+				continue
+			}
+
+			if strings.HasPrefix(prelude, "@") {
+				name, rest := splitAtRuleName(prelude)
+				return &css.Rule{
+					Kind:    css.AtRule,
+					Name:    name,
+					Prelude: rest,
+				}, i, nil
+			}
+			// a bare qualified rule with no declaration block (eg. `p;`) is
+			// not valid CSS: silently drop it, like browsers do
+
+		case '{':
+			blockEnd, err := matchBrace(text, end)
+			if err != nil {
+				return nil, i, err
+			}
+			block := text[end+1 : blockEnd]
+			i = blockEnd + 1
+
+			if prelude == "" {
+				continue
+			}
+
+			if strings.HasPrefix(prelude, "@") {
+				name, rest := splitAtRuleName(prelude)
+				rule := &css.Rule{
+					Kind:     css.AtRule,
+					Name:     name,
+					Prelude:  rest,
+					HasBlock: true,
+				}
+
+				if hasTopLevelBlock(block) {
+					nested, err := parseRules(block)
+					if err != nil {
+						return nil, i, err
+					}
+					rule.Rules = nested
+				} else {
+					decls, err := parseDeclarations(block)
+					if err != nil {
+						return nil, i, err
+					}
+					rule.Declarations = decls
+				}
+
+				attachSupportsCondition(rule)
+
+				return rule, i, nil
+			}
+
+			var decls []*css.Declaration
+			var nestedRules []*css.Rule
+
+			if hasTopLevelBlock(block) {
+				// the CSS Nesting Module: this qualified rule's block embeds
+				// further rules (possibly using `&`) alongside declarations
+				decls, nestedRules, err = parseMixedBody(block)
+			} else {
+				decls, err = parseDeclarations(block)
+			}
+			if err != nil {
+				return nil, i, err
+			}
+
+			parsedSelectors, err := ParseSelectorList(prelude)
+			if err != nil {
+				return nil, i, err
+			}
+
+			return &css.Rule{
+				Kind:            css.QualifiedRule,
+				Prelude:         prelude,
+				Selectors:       splitSelectors(prelude),
+				ParsedSelectors: parsedSelectors,
+				Declarations:    decls,
+				Rules:           nestedRules,
+				HasBlock:        true,
+			}, i, nil
+
+		default: // EOF with no terminator: ignore trailing garbage
+			return nil, n, nil
+		}
+	}
+
+	return nil, i, nil
+}
+
+// parseDeclarations parses a declaration list (the content of a `{ ... }`
+// block, or of a standalone `style` attribute)
+func parseDeclarations(text string) ([]*css.Declaration, error) {
+	var decls []*css.Declaration
+
+	for _, stmt := range splitTopLevel(text, ';') {
+		stmt = strings.TrimSpace(stmt)
+		if stmt == "" {
+			continue
+		}
+
+		if decl, ok := parseDeclarationStmt(stmt); ok {
+			decls = append(decls, decl)
+		}
+		// malformed declarations are dropped rather than failing the whole parse
+	}
+
+	return decls, nil
+}
+
+// parseDeclarationStmt parses a single `property: value[ !important]`
+// statement, returning ok false if it has no top-level colon
+func parseDeclarationStmt(stmt string) (*css.Declaration, bool) {
+	idx := topLevelIndex(stmt, ':')
+	if idx < 0 {
+		return nil, false
+	}
+
+	property := strings.TrimSpace(stmt[:idx])
+	value := strings.TrimSpace(stmt[idx+1:])
+
+	important := false
+	if loc := importantRegexp.FindStringIndex(value); loc != nil {
+		important = true
+		value = strings.TrimSpace(value[:loc[0]])
+	}
+
+	return &css.Declaration{
+		Property:  property,
+		Value:     value,
+		Important: important,
+		VarRefs:   parseVarRefs(value),
+	}, true
+}
+
+// parseMixedBody parses the content of a qualified rule's block under the
+// CSS Nesting Module, where declarations and further nested rules (other
+// qualified rules, or at-rules such as `@media`) may appear side by side
+func parseMixedBody(text string) ([]*css.Declaration, []*css.Rule, error) {
+	var decls []*css.Declaration
+	var rules []*css.Rule
+
+	n := len(text)
+	for i := 0; i < n; {
+		for i < n && isSpace(text[i]) {
+			i++
+		}
+		if i >= n {
+			break
+		}
+
+		start := i
+		end, terminator, err := scanStatement(text, i)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		prelude := strings.TrimSpace(text[start:end])
+
+		switch terminator {
+		case ';':
+			i = end + 1
+			if prelude == "" {
+				continue
+			}
+			if decl, ok := parseDeclarationStmt(prelude); ok {
+				decls = append(decls, decl)
+			}
+
+		case '{':
+			blockEnd, err := matchBrace(text, end)
+			if err != nil {
+				return nil, nil, err
+			}
+			block := text[end+1 : blockEnd]
+			i = blockEnd + 1
+
+			if prelude == "" {
+				continue
+			}
+
+			if strings.HasPrefix(prelude, "@") {
+				rule, err := parseNestedAtRule(prelude, block)
+				if err != nil {
+					return nil, nil, err
+				}
+				rules = append(rules, rule)
+				continue
+			}
+
+			nestedDecls, nestedRules, err := parseMixedBody(block)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			parsedSelectors, err := ParseSelectorList(prelude)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			rules = append(rules, &css.Rule{
+				Kind:            css.QualifiedRule,
+				Prelude:         prelude,
+				Selectors:       splitSelectors(prelude),
+				ParsedSelectors: parsedSelectors,
+				Declarations:    nestedDecls,
+				Rules:           nestedRules,
+				HasBlock:        true,
+			})
+
+		default: // EOF with no terminator: ignore trailing garbage
+			i = n
+		}
+	}
+
+	return decls, rules, nil
+}
+
+// parseNestedAtRule builds the Rule for an at-rule nested inside a
+// qualified rule's block. Its own block may hold further nested rules
+// (`@media { &:hover { ... } }`), or declarations applying directly to the
+// enclosing selector (`@media (...) { color: red; }`)
+func parseNestedAtRule(prelude, block string) (*css.Rule, error) {
+	name, rest := splitAtRuleName(prelude)
+	rule := &css.Rule{Kind: css.AtRule, Name: name, Prelude: rest, HasBlock: true}
+
+	decls, nested, err := parseMixedBody(block)
+	if err != nil {
+		return nil, err
+	}
+	rule.Declarations = decls
+	rule.Rules = nested
+
+	attachSupportsCondition(rule)
+
+	return rule, nil
+}
+
+// splitAtRuleName splits an at-rule prelude into its keyword (eg. "@media")
+// and the remaining prelude text
+func splitAtRuleName(prelude string) (name string, rest string) {
+	i := 1 // skip leading '@'
+	for i < len(prelude) && isIdentChar(prelude[i]) {
+		i++
+	}
+	return prelude[:i], strings.TrimSpace(prelude[i:])
+}
+
+// splitSelectors splits a qualified rule's prelude into its comma-separated
+// selectors
+func splitSelectors(prelude string) []string {
+	parts := splitTopLevel(prelude, ',')
+	selectors := make([]string, len(parts))
+	for i, p := range parts {
+		selectors[i] = strings.TrimSpace(p)
+	}
+	return selectors
+}
+
+// scanStatement scans forward from i looking for the first top-level ';' or
+// '{' (ie. not inside a string, or a parenthesized/bracketed expression). It
+// returns the index of that terminator and which one was found, or the
+// index of the end of text and a zero byte if none was found.
+func scanStatement(text string, i int) (end int, terminator byte, err error) {
+	n := len(text)
+	depth := 0
+	var inString byte
+
+	for ; i < n; i++ {
+		c := text[i]
+
+		if inString != 0 {
+			if c == '\\' {
+				i++
+			} else if c == inString {
+				inString = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '"', '\'':
+			inString = c
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case '{', ';':
+			if depth == 0 {
+				return i, c, nil
+			}
+		}
+	}
+
+	if inString != 0 {
+		return n, 0, fmt.Errorf("unterminated string")
+	}
+
+	return n, 0, nil
+}
+
+// matchBrace returns the index of the '}' matching the '{' at openIdx
+func matchBrace(text string, openIdx int) (int, error) {
+	depth := 0
+	var inString byte
+
+	for i := openIdx; i < len(text); i++ {
+		c := text[i]
+
+		if inString != 0 {
+			if c == '\\' {
+				i++
+			} else if c == inString {
+				inString = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '"', '\'':
+			inString = c
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+
+	return -1, fmt.Errorf("unterminated block, starting at offset %d", openIdx)
+}
+
+// hasTopLevelBlock reports whether text contains a top-level '{', which
+// distinguishes an at-rule embedding nested rules (`@media`, `@keyframes`,
+// ...) from one embedding plain declarations (`@font-face`, `@page`, ...)
+func hasTopLevelBlock(text string) bool {
+	var inString byte
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+
+		if inString != 0 {
+			if c == '\\' {
+				i++
+			} else if c == inString {
+				inString = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '"', '\'':
+			inString = c
+		case '{':
+			return true
+		}
+	}
+
+	return false
+}
+
+// span is a half-open [start, end) byte range into some text
+type span struct {
+	start, end int
+}
+
+// splitTopLevel splits text on every occurrence of sep that is not nested
+// inside a string or a parenthesized/bracketed expression
+func splitTopLevel(text string, sep byte) []string {
+	spans := splitTopLevelSpans(text, sep)
+	parts := make([]string, len(spans))
+	for i, s := range spans {
+		parts[i] = text[s.start:s.end]
+	}
+	return parts
+}
+
+// splitTopLevelSpans is splitTopLevel, but returns byte ranges into text
+// instead of copying out substrings, so that callers can recover the
+// original offset of each part
+func splitTopLevelSpans(text string, sep byte) []span {
+	var spans []span
+
+	depth := 0
+	var inString byte
+	start := 0
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+
+		if inString != 0 {
+			if c == '\\' {
+				i++
+			} else if c == inString {
+				inString = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '"', '\'':
+			inString = c
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		default:
+			if c == sep && depth == 0 {
+				spans = append(spans, span{start, i})
+				start = i + 1
+			}
+		}
+	}
+
+	spans = append(spans, span{start, len(text)})
+
+	return spans
+}
+
+// topLevelIndex returns the index of the first occurrence of sep that is
+// not nested inside a string or a parenthesized/bracketed expression, or -1
+func topLevelIndex(text string, sep byte) int {
+	depth := 0
+	var inString byte
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+
+		if inString != 0 {
+			if c == '\\' {
+				i++
+			} else if c == inString {
+				inString = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '"', '\'':
+			inString = c
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		default:
+			if c == sep && depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// stripComments removes `/* ... */` comments that are not nested inside a
+// string literal
+func stripComments(text string) string {
+	var b strings.Builder
+
+	var inString byte
+	n := len(text)
+
+	for i := 0; i < n; i++ {
+		c := text[i]
+
+		if inString != 0 {
+			b.WriteByte(c)
+			if c == '\\' && i+1 < n {
+				i++
+				b.WriteByte(text[i])
+			} else if c == inString {
+				inString = 0
+			}
+			continue
+		}
+
+		if c == '"' || c == '\'' {
+			inString = c
+			b.WriteByte(c)
+			continue
+		}
+
+		if c == '/' && i+1 < n && text[i+1] == '*' {
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				break
+			}
+			i += 2 + end + 1
+			continue
+		}
+
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isIdentChar(c byte) bool {
+	return c == '-' || c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
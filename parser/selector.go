@@ -0,0 +1,462 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Polymail/douceur/css"
+)
+
+var nthRegexp = regexp.MustCompile(`(?i)^\s*([+-]?\d*)n\s*([+-]\s*\d+)?\s*$|^\s*([+-]?\d+)\s*$`)
+
+var attrFlagRegexp = regexp.MustCompile(`(?i)\s+([is])\s*$`)
+
+// selectorListPseudos take a comma-separated selector list as their
+// functional argument, and so get it parsed into SimpleSelector.Args
+var selectorListPseudos = map[string]bool{
+	"not": true, "is": true, "where": true, "has": true,
+}
+
+// nthPseudos take an `An+B` expression as their functional argument
+var nthPseudos = map[string]bool{
+	"nth-child": true, "nth-last-child": true,
+	"nth-of-type": true, "nth-last-of-type": true,
+}
+
+// ParseSelectorList parses a comma-separated list of complex selectors, such
+// as a qualified rule's prelude
+func ParseSelectorList(raw string) ([]*css.Selector, error) {
+	var selectors []*css.Selector
+
+	for _, part := range splitTopLevel(raw, ',') {
+		sel, err := ParseSelector(part)
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, sel)
+	}
+
+	return selectors, nil
+}
+
+// ParseSelector parses a single complex selector, eg. `div > p.intro:hover`
+func ParseSelector(raw string) (*css.Selector, error) {
+	text := strings.TrimSpace(raw)
+
+	selector := &css.Selector{Raw: text}
+
+	combinator := css.Descendant
+	i, n := 0, len(text)
+
+	for i < n {
+		for i < n && isSpace(text[i]) {
+			i++
+		}
+		if i >= n {
+			break
+		}
+
+		if c := text[i]; c == '>' || c == '+' || c == '~' {
+			switch c {
+			case '>':
+				combinator = css.Child
+			case '+':
+				combinator = css.NextSibling
+			case '~':
+				combinator = css.SubsequentSibling
+			}
+			i++
+			continue
+		}
+
+		start := i
+		end, err := scanCompound(text, i)
+		if err != nil {
+			return nil, err
+		}
+
+		simples, err := parseSimpleSelectors(text[start:end])
+		if err != nil {
+			return nil, err
+		}
+
+		selector.Compounds = append(selector.Compounds, &css.CompoundSelector{
+			Combinator: combinator,
+			Simples:    simples,
+		})
+
+		combinator = css.Descendant
+		i = end
+	}
+
+	return selector, nil
+}
+
+// scanCompound scans forward from i over a single compound selector, ie.
+// until the next combinator (whitespace, `>`, `+` or `~`) that is not
+// itself nested inside brackets/parens/a string
+func scanCompound(text string, i int) (int, error) {
+	n := len(text)
+	depth := 0
+	var inString byte
+
+	for ; i < n; i++ {
+		c := text[i]
+
+		if inString != 0 {
+			if c == '\\' {
+				i++
+			} else if c == inString {
+				inString = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '"', '\'':
+			inString = c
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		default:
+			if depth == 0 && (isSpace(c) || c == '>' || c == '+' || c == '~') {
+				return i, nil
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// parseSimpleSelectors parses every simple selector chained in a single
+// compound selector, eg. `div.warning#id:hover`
+func parseSimpleSelectors(text string) ([]*css.SimpleSelector, error) {
+	var simples []*css.SimpleSelector
+
+	i, n := 0, len(text)
+	for i < n {
+		simple, end, err := parseSimpleSelector(text, i)
+		if err != nil {
+			return nil, err
+		}
+		simples = append(simples, simple)
+		i = end
+	}
+
+	return simples, nil
+}
+
+// parseSimpleSelector parses the single simple selector starting at i,
+// returning it along with the index right after it
+func parseSimpleSelector(text string, i int) (*css.SimpleSelector, int, error) {
+	n := len(text)
+	c := text[i]
+
+	switch {
+	case c == '#':
+		value, end := scanIdent(text, i+1)
+		return &css.SimpleSelector{Kind: css.IDSimpleSelector, Value: value}, end, nil
+
+	case c == '.':
+		value, end := scanIdent(text, i+1)
+		return &css.SimpleSelector{Kind: css.ClassSimpleSelector, Value: value}, end, nil
+
+	case c == '[':
+		return parseAttrSelector(text, i)
+
+	case c == ':':
+		kind := css.PseudoClassSimpleSelector
+		j := i + 1
+		if j < n && text[j] == ':' {
+			kind = css.PseudoElementSimpleSelector
+			j++
+		}
+		name, end := scanIdent(text, j)
+		simple := &css.SimpleSelector{Kind: kind, Value: name}
+
+		if end < n && text[end] == '(' {
+			closeIdx, err := matchParen(text, end)
+			if err != nil {
+				return nil, 0, err
+			}
+			arg := text[end+1 : closeIdx]
+			simple.Raw = arg
+			end = closeIdx + 1
+
+			lower := strings.ToLower(name)
+			switch {
+			case selectorListPseudos[lower]:
+				args, err := ParseSelectorList(arg)
+				if err != nil {
+					return nil, 0, err
+				}
+				simple.Args = args
+			case nthPseudos[lower]:
+				if a, b, ok := parseNth(arg); ok {
+					simple.NthA, simple.NthB, simple.HasNth = a, b, true
+				}
+			}
+		}
+
+		return simple, end, nil
+
+	case c == '&':
+		// CSS Nesting Module's reference to the parent selector, resolved by
+		// css.Stylesheet.Flatten
+		return &css.SimpleSelector{Kind: css.NestingSimpleSelector, Value: "&"}, i + 1, nil
+
+	case c == '*':
+		// universal selector, or the `*|` any-namespace prefix of a universal
+		// or type selector (`*|*`, `*|rect`)
+		if ns, end, ok := scanNamespacePrefix(text, i); ok {
+			if end < n && text[end] == '*' {
+				return &css.SimpleSelector{Kind: css.UniversalSimpleSelector, Namespace: ns}, end + 1, nil
+			}
+			value, valueEnd := scanIdent(text, end)
+			return &css.SimpleSelector{Kind: css.TypeSimpleSelector, Namespace: ns, Value: value}, valueEnd, nil
+		}
+		return &css.SimpleSelector{Kind: css.UniversalSimpleSelector}, i + 1, nil
+
+	default:
+		if ns, end, ok := scanNamespacePrefix(text, i); ok {
+			if end < n && text[end] == '*' {
+				return &css.SimpleSelector{Kind: css.UniversalSimpleSelector, Namespace: ns}, end + 1, nil
+			}
+			value, valueEnd := scanIdent(text, end)
+			return &css.SimpleSelector{Kind: css.TypeSimpleSelector, Namespace: ns, Value: value}, valueEnd, nil
+		}
+
+		value, end := scanIdent(text, i)
+		if value == "" {
+			// unrecognized character: skip it rather than looping forever
+			return &css.SimpleSelector{Kind: css.TypeSimpleSelector, Value: string(c)}, i + 1, nil
+		}
+		return &css.SimpleSelector{Kind: css.TypeSimpleSelector, Value: value}, end, nil
+	}
+}
+
+// scanNamespacePrefix recognizes a `ns|` or `*|` namespace prefix at i,
+// taking care not to mistake an attribute operator (`[attr|=value]`) for one
+func scanNamespacePrefix(text string, i int) (ns string, end int, ok bool) {
+	n := len(text)
+	start := i
+
+	if i < n && text[i] == '*' {
+		i++
+	} else {
+		for i < n && isIdentChar(text[i]) {
+			i++
+		}
+	}
+
+	if i == start || i >= n || text[i] != '|' {
+		return "", 0, false
+	}
+	if i+1 < n && text[i+1] == '=' {
+		// that's an attribute operator, not a namespace separator
+		return "", 0, false
+	}
+
+	return text[start:i], i + 1, true
+}
+
+// scanIdent scans a CSS identifier (letters, digits, `-`, `_`, or a `\`
+// escaped character) starting at i
+func scanIdent(text string, i int) (string, int) {
+	start := i
+	n := len(text)
+	var b strings.Builder
+
+	for i < n {
+		c := text[i]
+		if c == '\\' && i+1 < n {
+			b.WriteByte(text[i+1])
+			i += 2
+			continue
+		}
+		if !isIdentChar(c) {
+			break
+		}
+		b.WriteByte(c)
+		i++
+	}
+
+	if i == start {
+		return "", start
+	}
+
+	return b.String(), i
+}
+
+// matchParen returns the index of the ')' matching the '(' at openIdx
+func matchParen(text string, openIdx int) (int, error) {
+	depth := 0
+	var inString byte
+
+	for i := openIdx; i < len(text); i++ {
+		c := text[i]
+
+		if inString != 0 {
+			if c == '\\' {
+				i++
+			} else if c == inString {
+				inString = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '"', '\'':
+			inString = c
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+
+	return -1, fmt.Errorf("unterminated parenthesis, starting at offset %d", openIdx)
+}
+
+// parseAttrSelector parses `[attr]`, `[attr=value]`, `[attr~=value]`, etc.,
+// starting at the `[`
+func parseAttrSelector(text string, i int) (*css.SimpleSelector, int, error) {
+	closeIdx, err := matchBracket(text, i)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	inner := strings.TrimSpace(text[i+1 : closeIdx])
+	simple := &css.SimpleSelector{Kind: css.AttrSimpleSelector}
+
+	// trailing case-sensitivity flag
+	if m := attrFlagRegexp.FindStringSubmatchIndex(inner); m != nil {
+		if strings.EqualFold(inner[m[2]:m[3]], "i") {
+			simple.AttrCaseInsensitive = true
+		}
+		inner = strings.TrimSpace(inner[:m[0]])
+	}
+
+	opIdx := -1
+	opLen := 0
+	for idx := 0; idx < len(inner); idx++ {
+		for _, op := range []string{"~=", "|=", "^=", "$=", "*=", "="} {
+			if strings.HasPrefix(inner[idx:], op) {
+				opIdx, opLen = idx, len(op)
+			}
+		}
+		if opIdx >= 0 {
+			break
+		}
+	}
+
+	if opIdx < 0 {
+		simple.Value = strings.TrimSpace(inner)
+		if ns, end, ok := scanNamespacePrefix(inner, 0); ok {
+			simple.Namespace = ns
+			simple.Value = strings.TrimSpace(inner[end:])
+		}
+		return simple, closeIdx + 1, nil
+	}
+
+	name := strings.TrimSpace(inner[:opIdx])
+	if ns, end, ok := scanNamespacePrefix(name, 0); ok {
+		simple.Namespace = ns
+		name = name[end:]
+	}
+	simple.Value = name
+	simple.AttrOp = inner[opIdx : opIdx+opLen]
+	simple.AttrValue = unquote(strings.TrimSpace(inner[opIdx+opLen:]))
+
+	return simple, closeIdx + 1, nil
+}
+
+// matchBracket returns the index of the ']' matching the '[' at openIdx
+func matchBracket(text string, openIdx int) (int, error) {
+	depth := 0
+	var inString byte
+
+	for i := openIdx; i < len(text); i++ {
+		c := text[i]
+
+		if inString != 0 {
+			if c == '\\' {
+				i++
+			} else if c == inString {
+				inString = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '"', '\'':
+			inString = c
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+
+	return -1, fmt.Errorf("unterminated attribute selector, starting at offset %d", openIdx)
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// parseNth parses the `An+B` micro-syntax of `:nth-child()` and friends. It
+// does not handle the `odd`/`even` keywords, which are uncommon enough in
+// practice to leave as unparsed Raw text for now.
+func parseNth(arg string) (a, b int, ok bool) {
+	m := nthRegexp.FindStringSubmatch(arg)
+	if m == nil {
+		return 0, 0, false
+	}
+
+	if m[3] != "" {
+		// plain integer, no `n` term
+		v, err := strconv.Atoi(strings.ReplaceAll(m[3], " ", ""))
+		if err != nil {
+			return 0, 0, false
+		}
+		return 0, v, true
+	}
+
+	aStr := m[1]
+	switch aStr {
+	case "", "+":
+		a = 1
+	case "-":
+		a = -1
+	default:
+		v, err := strconv.Atoi(aStr)
+		if err != nil {
+			return 0, 0, false
+		}
+		a = v
+	}
+
+	bStr := strings.ReplaceAll(m[2], " ", "")
+	if bStr != "" {
+		v, err := strconv.Atoi(bStr)
+		if err != nil {
+			return 0, 0, false
+		}
+		b = v
+	}
+
+	return a, b, true
+}
@@ -0,0 +1,169 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/Polymail/douceur/css"
+)
+
+func TestParseSelectorSimple(t *testing.T) {
+	sel, err := ParseSelector("div.warning#id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sel.Compounds) != 1 {
+		t.Fatalf("expected a single compound selector, got %d", len(sel.Compounds))
+	}
+
+	compound := sel.Compounds[0]
+	if len(compound.Simples) != 3 {
+		t.Fatalf("expected 3 simple selectors, got %d", len(compound.Simples))
+	}
+
+	if compound.Simples[0].Kind != css.TypeSimpleSelector || compound.Simples[0].Value != "div" {
+		t.Fatalf("unexpected first simple selector: %+v", compound.Simples[0])
+	}
+	if compound.Simples[1].Kind != css.ClassSimpleSelector || compound.Simples[1].Value != "warning" {
+		t.Fatalf("unexpected second simple selector: %+v", compound.Simples[1])
+	}
+	if compound.Simples[2].Kind != css.IDSimpleSelector || compound.Simples[2].Value != "id" {
+		t.Fatalf("unexpected third simple selector: %+v", compound.Simples[2])
+	}
+
+	if got := sel.Specificity(); got != (css.Specificity{A: 1, B: 1, C: 1}) {
+		t.Fatalf("unexpected specificity: %+v", got)
+	}
+}
+
+func TestParseSelectorCombinators(t *testing.T) {
+	testcases := map[string][]css.Combinator{
+		"div p":   {css.Descendant, css.Descendant},
+		"div > p": {css.Descendant, css.Child},
+		"div + p": {css.Descendant, css.NextSibling},
+		"div ~ p": {css.Descendant, css.SubsequentSibling},
+	}
+
+	for input, expected := range testcases {
+		sel, err := ParseSelector(input)
+		if err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		if len(sel.Compounds) != len(expected) {
+			t.Fatalf("%s: expected %d compounds, got %d", input, len(expected), len(sel.Compounds))
+		}
+		for i, c := range expected {
+			if sel.Compounds[i].Combinator != c {
+				t.Fatalf("%s: compound %d: expected combinator %v, got %v", input, i, c, sel.Compounds[i].Combinator)
+			}
+		}
+	}
+}
+
+func TestParseSelectorAttr(t *testing.T) {
+	testcases := map[string]*css.SimpleSelector{
+		`[href]`:            {Kind: css.AttrSimpleSelector, Value: "href"},
+		`[type=text]`:       {Kind: css.AttrSimpleSelector, Value: "type", AttrOp: "=", AttrValue: "text"},
+		`[data-x="a b"]`:    {Kind: css.AttrSimpleSelector, Value: "data-x", AttrOp: "=", AttrValue: "a b"},
+		`[class~=foo]`:      {Kind: css.AttrSimpleSelector, Value: "class", AttrOp: "~=", AttrValue: "foo"},
+		`[lang|=en]`:        {Kind: css.AttrSimpleSelector, Value: "lang", AttrOp: "|=", AttrValue: "en"},
+		`[type=text i]`:     {Kind: css.AttrSimpleSelector, Value: "type", AttrOp: "=", AttrValue: "text", AttrCaseInsensitive: true},
+		`[svg|href="#foo"]`: {Kind: css.AttrSimpleSelector, Namespace: "svg", Value: "href", AttrOp: "=", AttrValue: "#foo"},
+	}
+
+	for input, expected := range testcases {
+		sel, err := ParseSelector(input)
+		if err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		simple := sel.Compounds[0].Simples[0]
+		if simple.Kind != expected.Kind || simple.Namespace != expected.Namespace || simple.Value != expected.Value ||
+			simple.AttrOp != expected.AttrOp || simple.AttrValue != expected.AttrValue || simple.AttrCaseInsensitive != expected.AttrCaseInsensitive {
+			t.Fatalf("%s: got %+v, expected %+v", input, simple, expected)
+		}
+	}
+}
+
+func TestParseSelectorPseudo(t *testing.T) {
+	sel, err := ParseSelector("a::before")
+	if err != nil {
+		t.Fatal(err)
+	}
+	simples := sel.Compounds[0].Simples
+	if simples[1].Kind != css.PseudoElementSimpleSelector || simples[1].Value != "before" {
+		t.Fatalf("unexpected pseudo-element: %+v", simples[1])
+	}
+}
+
+func TestParseSelectorFunctionalPseudo(t *testing.T) {
+	sel, err := ParseSelector("li:nth-child(2n+1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	simple := sel.Compounds[0].Simples[1]
+	if !simple.HasNth || simple.NthA != 2 || simple.NthB != 1 {
+		t.Fatalf("unexpected nth-child parse: %+v", simple)
+	}
+
+	sel, err = ParseSelector(":is(a, b.c)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	simple = sel.Compounds[0].Simples[0]
+	if len(simple.Args) != 2 {
+		t.Fatalf("expected 2 arguments to :is(), got %d", len(simple.Args))
+	}
+	if simple.Args[0].Raw != "a" || simple.Args[1].Raw != "b.c" {
+		t.Fatalf("unexpected :is() arguments: %+v", simple.Args)
+	}
+}
+
+func TestParseSelectorNot(t *testing.T) {
+	sel, err := ParseSelector("p:not(.intro)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// :not() takes the specificity of its argument, here a class (0,1,0),
+	// plus the type selector `p` (0,0,1)
+	if got := sel.Specificity(); got != (css.Specificity{B: 1, C: 1}) {
+		t.Fatalf("unexpected specificity: %+v", got)
+	}
+}
+
+func TestParseSelectorNamespace(t *testing.T) {
+	sel, err := ParseSelector("svg|rect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	simple := sel.Compounds[0].Simples[0]
+	if simple.Namespace != "svg" || simple.Value != "rect" {
+		t.Fatalf("unexpected namespaced selector: %+v", simple)
+	}
+}
+
+func TestParseSelectorEscapes(t *testing.T) {
+	sel, err := ParseSelector(`.foo\.bar`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	simple := sel.Compounds[0].Simples[0]
+	if simple.Value != "foo.bar" {
+		t.Fatalf("unexpected escaped class name: %q", simple.Value)
+	}
+}
+
+func TestRuleParsedSelectors(t *testing.T) {
+	stylesheet, err := Parse("div.a, p > span { color: red; }")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rule := stylesheet.Rules[0]
+	if len(rule.ParsedSelectors) != 2 {
+		t.Fatalf("expected 2 parsed selectors, got %d", len(rule.ParsedSelectors))
+	}
+	if rule.ParsedSelectors[0].Raw != "div.a" || rule.ParsedSelectors[1].Raw != "p > span" {
+		t.Fatalf("unexpected parsed selectors: %+v", rule.ParsedSelectors)
+	}
+}
@@ -0,0 +1,246 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Polymail/douceur/css"
+)
+
+// attachSupportsCondition populates rule.SupportsCondition by parsing its
+// Prelude, if rule is an `@supports` at-rule with a non-empty one. A
+// prelude that fails to parse is left as nil rather than failing the rule
+// itself, since SupportsCondition is a structured convenience on top of the
+// always-available raw Prelude.
+func attachSupportsCondition(rule *css.Rule) {
+	if rule.Name != "@supports" || rule.Prelude == "" {
+		return
+	}
+	if cond, err := ParseSupportsCondition(rule.Prelude); err == nil {
+		rule.SupportsCondition = cond
+	}
+}
+
+// ParseSupportsCondition parses an `@supports` prelude into a structured
+// css.SupportsCondition, handling `and`/`or`/`not` combinations and the
+// `selector(...)` function alongside plain feature queries.
+func ParseSupportsCondition(prelude string) (*css.SupportsCondition, error) {
+	p := &supportsParser{text: strings.TrimSpace(prelude)}
+
+	cond, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+	if p.pos != len(p.text) {
+		return nil, fmt.Errorf("unexpected trailing text in @supports prelude: %q", p.text[p.pos:])
+	}
+
+	return cond, nil
+}
+
+type supportsParser struct {
+	text string
+	pos  int
+}
+
+func (p *supportsParser) skipSpace() {
+	for p.pos < len(p.text) && isSpace(p.text[p.pos]) {
+		p.pos++
+	}
+}
+
+// peekKeyword reports whether the given case-insensitive keyword starts at
+// the current position, and ends on a word boundary (whitespace, '(' or EOF)
+func (p *supportsParser) peekKeyword(word string) bool {
+	n := len(word)
+	if p.pos+n > len(p.text) || !strings.EqualFold(p.text[p.pos:p.pos+n], word) {
+		return false
+	}
+	if p.pos+n < len(p.text) {
+		c := p.text[p.pos+n]
+		if !isSpace(c) && c != '(' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseCondition parses `not <in-parens>` or a chain of `<in-parens>`
+// joined by a single kind of connector (`and` or `or`). Mixing both
+// connectors at one level, without parentheses, is an error.
+func (p *supportsParser) parseCondition() (*css.SupportsCondition, error) {
+	p.skipSpace()
+
+	if p.peekKeyword("not") {
+		p.pos += len("not")
+		p.skipSpace()
+		operand, err := p.parseInParens()
+		if err != nil {
+			return nil, err
+		}
+		return &css.SupportsCondition{Kind: css.SupportsNot, Operands: []*css.SupportsCondition{operand}}, nil
+	}
+
+	first, err := p.parseInParens()
+	if err != nil {
+		return nil, err
+	}
+
+	operands := []*css.SupportsCondition{first}
+	var connector css.SupportsConditionKind
+
+	for {
+		p.skipSpace()
+
+		switch {
+		case p.peekKeyword("and"):
+			if connector == css.SupportsOr {
+				return nil, fmt.Errorf("cannot mix 'and' and 'or' without parentheses at offset %d", p.pos)
+			}
+			connector = css.SupportsAnd
+			p.pos += len("and")
+		case p.peekKeyword("or"):
+			if connector == css.SupportsAnd {
+				return nil, fmt.Errorf("cannot mix 'and' and 'or' without parentheses at offset %d", p.pos)
+			}
+			connector = css.SupportsOr
+			p.pos += len("or")
+		default:
+			if len(operands) == 1 {
+				return operands[0], nil
+			}
+			return &css.SupportsCondition{Kind: connector, Operands: operands}, nil
+		}
+
+		p.skipSpace()
+		next, err := p.parseInParens()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, next)
+	}
+}
+
+// parseInParens parses a `selector(...)` function, or a parenthesized group
+// which is either a nested condition or a plain feature declaration
+func (p *supportsParser) parseInParens() (*css.SupportsCondition, error) {
+	p.skipSpace()
+
+	if p.peekKeyword("selector") {
+		p.pos += len("selector")
+		p.skipSpace()
+
+		if p.pos >= len(p.text) || p.text[p.pos] != '(' {
+			return nil, fmt.Errorf("expected '(' after selector at offset %d", p.pos)
+		}
+		open := p.pos
+		closeIdx, err := matchParen(p.text, open)
+		if err != nil {
+			return nil, err
+		}
+
+		inner := p.text[open+1 : closeIdx]
+		selector, err := ParseSelector(inner)
+		if err != nil {
+			return nil, err
+		}
+		p.pos = closeIdx + 1
+
+		return &css.SupportsCondition{Kind: css.SupportsSelectorFunc, Selector: selector, Raw: "selector(" + inner + ")"}, nil
+	}
+
+	if p.pos >= len(p.text) || p.text[p.pos] != '(' {
+		return nil, fmt.Errorf("expected '(' at offset %d", p.pos)
+	}
+	open := p.pos
+	closeIdx, err := matchParen(p.text, open)
+	if err != nil {
+		return nil, err
+	}
+	inner := strings.TrimSpace(p.text[open+1 : closeIdx])
+	p.pos = closeIdx + 1
+
+	if looksLikeSupportsCondition(inner) {
+		sub := &supportsParser{text: inner}
+		cond, err := sub.parseCondition()
+		if err != nil {
+			return nil, err
+		}
+		sub.skipSpace()
+		if sub.pos != len(sub.text) {
+			return nil, fmt.Errorf("unexpected trailing text in @supports condition: %q", inner[sub.pos:])
+		}
+		return cond, nil
+	}
+
+	idx := topLevelIndex(inner, ':')
+	if idx < 0 {
+		return &css.SupportsCondition{Kind: css.SupportsFeature, Raw: inner}, nil
+	}
+
+	return &css.SupportsCondition{
+		Kind:     css.SupportsFeature,
+		Property: strings.TrimSpace(inner[:idx]),
+		Value:    strings.TrimSpace(inner[idx+1:]),
+	}, nil
+}
+
+// looksLikeSupportsCondition reports whether the content of a parenthesized
+// group is itself a (possibly nested) condition, as opposed to a plain
+// `property: value` feature declaration
+func looksLikeSupportsCondition(inner string) bool {
+	trimmed := strings.TrimSpace(inner)
+	if trimmed == "" {
+		return false
+	}
+	if trimmed[0] == '(' {
+		return true
+	}
+
+	lower := strings.ToLower(trimmed)
+	if hasWordPrefix(lower, trimmed, "not") || hasWordPrefix(lower, trimmed, "selector") {
+		return true
+	}
+
+	return hasTopLevelKeyword(trimmed, "and") || hasTopLevelKeyword(trimmed, "or")
+}
+
+func hasWordPrefix(lower, original, word string) bool {
+	if !strings.HasPrefix(lower, word) {
+		return false
+	}
+	if len(original) == len(word) {
+		return true
+	}
+	c := original[len(word)]
+	return isSpace(c) || c == '('
+}
+
+// hasTopLevelKeyword reports whether word appears as a whitespace-bounded
+// token in text, outside of any nested parentheses
+func hasTopLevelKeyword(text, word string) bool {
+	lower := strings.ToLower(text)
+	wlen := len(word)
+	depth := 0
+
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+
+		if depth == 0 && i+wlen <= len(lower) && lower[i:i+wlen] == word {
+			before := i == 0 || isSpace(text[i-1])
+			after := i+wlen == len(text) || isSpace(text[i+wlen])
+			if before && after {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,102 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/Polymail/douceur/css"
+)
+
+func TestParseSupportsFeature(t *testing.T) {
+	cond, err := ParseSupportsCondition("(animation-name: test)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cond.Kind != css.SupportsFeature || cond.Property != "animation-name" || cond.Value != "test" {
+		t.Fatalf("unexpected condition: %+v", cond)
+	}
+}
+
+func TestParseSupportsNot(t *testing.T) {
+	cond, err := ParseSupportsCondition("not (display: grid)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cond.Kind != css.SupportsNot {
+		t.Fatalf("expected SupportsNot, got %+v", cond)
+	}
+	if cond.Operands[0].Property != "display" {
+		t.Fatalf("unexpected operand: %+v", cond.Operands[0])
+	}
+}
+
+func TestParseSupportsAndOr(t *testing.T) {
+	cond, err := ParseSupportsCondition("(display: grid) and (display: flex)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cond.Kind != css.SupportsAnd || len(cond.Operands) != 2 {
+		t.Fatalf("unexpected condition: %+v", cond)
+	}
+
+	cond, err = ParseSupportsCondition("(display: grid) or (display: flex) or (display: inline-grid)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cond.Kind != css.SupportsOr || len(cond.Operands) != 3 {
+		t.Fatalf("unexpected condition: %+v", cond)
+	}
+}
+
+func TestParseSupportsNested(t *testing.T) {
+	cond, err := ParseSupportsCondition("((display: grid) and (display: flex)) or (not (display: inline-grid))")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cond.Kind != css.SupportsOr || len(cond.Operands) != 2 {
+		t.Fatalf("unexpected top-level condition: %+v", cond)
+	}
+	if cond.Operands[0].Kind != css.SupportsAnd {
+		t.Fatalf("expected nested SupportsAnd, got %+v", cond.Operands[0])
+	}
+	if cond.Operands[1].Kind != css.SupportsNot {
+		t.Fatalf("expected nested SupportsNot, got %+v", cond.Operands[1])
+	}
+}
+
+func TestParseSupportsSelectorFunc(t *testing.T) {
+	cond, err := ParseSupportsCondition("selector(:is(a, b))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cond.Kind != css.SupportsSelectorFunc || cond.Selector == nil {
+		t.Fatalf("unexpected condition: %+v", cond)
+	}
+	if cond.Selector.Raw != ":is(a, b)" {
+		t.Fatalf("unexpected selector: %+v", cond.Selector)
+	}
+}
+
+func TestEvaluateSupports(t *testing.T) {
+	stylesheet, err := Parse(`@supports (display: grid) and (not (display: flex)) {
+  div { color: red; }
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rule := stylesheet.Rules[0]
+	if rule.SupportsCondition == nil {
+		t.Fatal("expected a parsed SupportsCondition")
+	}
+
+	caps := css.SupportsCapabilities{
+		SupportsDeclaration: func(property, value string) bool {
+			return property == "display" && value == "grid"
+		},
+	}
+
+	if !rule.EvaluateSupports(caps) {
+		t.Fatal("expected condition to evaluate to true")
+	}
+}
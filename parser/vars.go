@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/Polymail/douceur/css"
+)
+
+// parseVarRefs scans value for every `var(--name[, fallback])` call,
+// including ones nested inside other functions (eg. `calc(var(--x) + 1px)`),
+// and returns them in order of occurrence. A var() call inside another
+// var()'s fallback is not listed on its own; it stays part of that
+// fallback's raw text.
+func parseVarRefs(value string) []*css.VarRef {
+	var refs []*css.VarRef
+
+	lower := strings.ToLower(value)
+	for i := 0; i+4 <= len(lower); {
+		idx := strings.Index(lower[i:], "var(")
+		if idx < 0 {
+			break
+		}
+		matchStart := i + idx
+
+		if matchStart > 0 && isIdentChar(lower[matchStart-1]) {
+			i = matchStart + 4
+			continue
+		}
+
+		openIdx := matchStart + 3
+
+		closeIdx, err := matchParen(value, openIdx)
+		if err != nil {
+			i = openIdx + 1
+			continue
+		}
+
+		inner := value[openIdx+1 : closeIdx]
+		name, fallback := splitVarArgs(inner)
+
+		refs = append(refs, &css.VarRef{
+			Name:     name,
+			Fallback: fallback,
+			Raw:      value[openIdx-3 : closeIdx+1],
+		})
+
+		i = closeIdx + 1
+	}
+
+	return refs
+}
+
+// splitVarArgs splits a var() call's argument list into the custom property
+// name and the raw fallback text (empty if there is none)
+func splitVarArgs(args string) (name, fallback string) {
+	idx := topLevelIndex(args, ',')
+	if idx < 0 {
+		return strings.TrimSpace(args), ""
+	}
+	return strings.TrimSpace(args[:idx]), strings.TrimSpace(args[idx+1:])
+}
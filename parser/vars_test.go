@@ -0,0 +1,109 @@
+package parser
+
+import "testing"
+
+func TestParseCustomProperty(t *testing.T) {
+	stylesheet := MustParse(t, ":root { --emph: red; }", 1)
+
+	decl := stylesheet.Rules[0].Declarations[0]
+	if decl.Property != "--emph" || decl.Value != "red" {
+		t.Fatalf("unexpected declaration: %+v", decl)
+	}
+	if len(decl.VarRefs) != 0 {
+		t.Fatalf("expected no var refs, got %+v", decl.VarRefs)
+	}
+}
+
+func TestParseVarRef(t *testing.T) {
+	stylesheet := MustParse(t, "p { color: var(--emph); }", 1)
+
+	decl := stylesheet.Rules[0].Declarations[0]
+	if len(decl.VarRefs) != 1 {
+		t.Fatalf("expected 1 var ref, got %+v", decl.VarRefs)
+	}
+
+	ref := decl.VarRefs[0]
+	if ref.Name != "--emph" || ref.Fallback != "" || ref.Raw != "var(--emph)" {
+		t.Fatalf("unexpected var ref: %+v", ref)
+	}
+}
+
+func TestParseVarRefWithFallback(t *testing.T) {
+	stylesheet := MustParse(t, "p { border: 1px solid var(--border-color, #ccc); }", 1)
+
+	decl := stylesheet.Rules[0].Declarations[0]
+	if len(decl.VarRefs) != 1 {
+		t.Fatalf("expected 1 var ref, got %+v", decl.VarRefs)
+	}
+
+	ref := decl.VarRefs[0]
+	if ref.Name != "--border-color" || ref.Fallback != "#ccc" {
+		t.Fatalf("unexpected var ref: %+v", ref)
+	}
+}
+
+func TestResolveVarsFromRoot(t *testing.T) {
+	stylesheet := MustParse(t, ":root { --emph: red; } p { color: var(--emph); }", 2)
+
+	diags := stylesheet.ResolveVars()
+	if len(diags) != 0 {
+		t.Fatalf("expected no diagnostics, got %+v", diags)
+	}
+
+	decl := stylesheet.Rules[1].Declarations[0]
+	if decl.Value != "red" {
+		t.Fatalf("expected resolved value %q, got %q", "red", decl.Value)
+	}
+}
+
+func TestResolveVarsFallback(t *testing.T) {
+	stylesheet := MustParse(t, "p { color: var(--missing, blue); }", 1)
+
+	diags := stylesheet.ResolveVars()
+	if len(diags) != 0 {
+		t.Fatalf("expected no diagnostics, got %+v", diags)
+	}
+
+	decl := stylesheet.Rules[0].Declarations[0]
+	if decl.Value != "blue" {
+		t.Fatalf("expected fallback value %q, got %q", "blue", decl.Value)
+	}
+}
+
+func TestResolveVarsUnresolved(t *testing.T) {
+	stylesheet := MustParse(t, "p { color: var(--missing); }", 1)
+
+	diags := stylesheet.ResolveVars()
+	if len(diags) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %+v", diags)
+	}
+	if diags[0].Property != "color" || diags[0].Name != "--missing" {
+		t.Fatalf("unexpected diagnostic: %+v", diags[0])
+	}
+
+	decl := stylesheet.Rules[0].Declarations[0]
+	if decl.Value != "var(--missing)" {
+		t.Fatalf("expected value left untouched, got %q", decl.Value)
+	}
+}
+
+func TestResolveVarsPerSelectorScope(t *testing.T) {
+	stylesheet := MustParse(t, ".dark { --bg: black; } .light { --bg: white; } .dark p { background: var(--bg); }", 3)
+
+	diags := stylesheet.ResolveVars()
+	if len(diags) != 0 {
+		t.Fatalf("expected no diagnostics, got %+v", diags)
+	}
+
+	decl := stylesheet.Rules[2].Declarations[0]
+	if decl.Value != "black" {
+		t.Fatalf("expected %q's --bg to resolve from its own .dark scope, got %q", ".dark p", decl.Value)
+	}
+}
+
+func TestParseVarRefsIgnoresEmbeddedMatch(t *testing.T) {
+	refs := parseVarRefs("foovar(5)")
+	if len(refs) != 0 {
+		t.Fatalf("expected no var refs in a name that merely ends in \"var(\", got %+v", refs)
+	}
+}